@@ -0,0 +1,265 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+// Package cache wraps an easykv.ReadWatcher and serves GetValues from memory.
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+// DefaultTTL is the lifetime of cached values.
+const DefaultTTL = time.Minute
+
+const (
+	// the first delay before a failed watch is started again, it doubles up to maxWatchBackoff
+	minWatchBackoff = 100 * time.Millisecond
+	maxWatchBackoff = time.Minute
+)
+
+// Client caches the values of every requested prefix.
+//
+// The values of a prefix are refreshed in the background whenever WatchPrefix reports a change.
+// They expire after the TTL anyway, as some backends can't report the changes between the fetch
+// and the start of the watch. If the backend doesn't support watches, the TTL is the only refresh.
+// Failed watches are started again with an increasing backoff.
+type Client struct {
+	rw  easykv.ReadWatcher
+	ttl time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu         sync.Mutex
+	entries    map[string]*entry
+	generation uint64 // incremented for every fetch
+	noWatch    bool   // the backend returned easykv.ErrWatchNotSupported
+	hits       uint64
+	misses     uint64
+	refreshes  uint64
+}
+
+type entry struct {
+	values     map[string]string
+	fetched    time.Time
+	generation uint64 // of the fetch that returned values
+	watching   bool
+}
+
+// Stats reports the efficiency of the cache.
+type Stats struct {
+	Hits      uint64 // prefixes served from memory
+	Misses    uint64 // prefixes fetched from the backend by GetValues
+	Refreshes uint64 // prefixes fetched in the background after a change
+
+	Entries  int // cached prefixes
+	Watching int // cached prefixes kept fresh by a watch
+
+	// Staleness is the age of the oldest cached values.
+	Staleness time.Duration
+}
+
+// HitRate returns the share of prefixes served from memory.
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// New returns a caching *cache.Client for rw.
+func New(rw easykv.ReadWatcher, opts ...Option) *Client {
+	c := &Client{
+		rw:      rw,
+		ttl:     DefaultTTL,
+		entries: make(map[string]*entry),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c
+}
+
+// GetValues is used to lookup all keys with a prefix.
+// Several prefixes can be specified in the keys array, every prefix is cached on its own.
+func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but a fetch from the backend is bound to ctx.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for _, key := range keys {
+		values, err := c.get(ctx, key)
+		if err != nil {
+			return vars, err
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+func (c *Client) get(ctx context.Context, prefix string) (map[string]string, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[prefix]; ok && time.Since(e.fetched) < c.ttl {
+		c.hits++
+		c.mu.Unlock()
+		return e.values, nil
+	}
+	c.misses++
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	values, err := easykv.GetValuesContext(ctx, c.rw, []string{prefix})
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.store(prefix, values, generation)
+	if !e.watching && !c.noWatch && c.ctx.Err() == nil {
+		e.watching = true
+		c.wg.Add(1)
+		go c.watch(prefix)
+	}
+	return e.values, nil
+}
+
+// store caches the values of prefix unless a later fetch already stored newer ones,
+// which happens if a refresh after a change finishes before an older fetch. c.mu must be held.
+func (c *Client) store(prefix string, values map[string]string, generation uint64) *entry {
+	e, ok := c.entries[prefix]
+	if !ok {
+		e = &entry{}
+		c.entries[prefix] = e
+	}
+	if generation > e.generation {
+		e.values = values
+		e.fetched = time.Now()
+		e.generation = generation
+	}
+	return e
+}
+
+// watch refreshes the values of prefix on every change.
+// It stops if the backend can't watch, the values are then kept for the TTL.
+// Other errors are retried with an increasing backoff.
+func (c *Client) watch(prefix string) {
+	defer c.wg.Done()
+
+	var waitIndex uint64
+	backoff := minWatchBackoff
+	for {
+		index, err := c.rw.WatchPrefix(c.ctx, prefix, easykv.WithKeys([]string{prefix}), easykv.WithWaitIndex(waitIndex))
+		if c.ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, easykv.ErrWatchNotSupported) {
+			c.mu.Lock()
+			c.noWatch = true
+			if e, ok := c.entries[prefix]; ok {
+				e.watching = false
+			}
+			c.mu.Unlock()
+			return
+		}
+		if err != nil {
+			select {
+			case <-time.After(backoff):
+			case <-c.ctx.Done():
+				return
+			}
+			backoff = min(2*backoff, maxWatchBackoff)
+			continue
+		}
+		backoff = minWatchBackoff
+		waitIndex = index
+
+		c.mu.Lock()
+		c.generation++
+		generation := c.generation
+		c.mu.Unlock()
+
+		values, err := easykv.GetValuesContext(c.ctx, c.rw, []string{prefix})
+		if c.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			// the next GetValues fetches the values again
+			c.mu.Lock()
+			delete(c.entries, prefix)
+			c.mu.Unlock()
+			return
+		}
+
+		c.mu.Lock()
+		c.refreshes++
+		c.store(prefix, values, generation).watching = true
+		c.mu.Unlock()
+	}
+}
+
+// Stats returns the current statistics of the cache.
+func (c *Client) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Refreshes: c.refreshes,
+		Entries:   len(c.entries),
+	}
+	for _, e := range c.entries {
+		if e.watching {
+			s.Watching++
+		}
+		if age := time.Since(e.fetched); age > s.Staleness {
+			s.Staleness = age
+		}
+	}
+	return s
+}
+
+// WatchPrefix watches the underlying backend.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	return c.rw.WatchPrefix(ctx, prefix, opts...)
+}
+
+// Close stops the background watches and closes the underlying backend.
+func (c *Client) Close() {
+	c.cancel()
+	c.wg.Wait()
+	c.rw.Close()
+}
+
+// Capabilities reports the watch and binary value support of the underlying backend.
+// The cache itself is read-only.
+func (c *Client) Capabilities() easykv.Capabilities {
+	caps := easykv.CapabilitiesOf(c.rw)
+	return easykv.Capabilities{Watch: caps.Watch, BinaryValues: caps.BinaryValues}
+}
+
+// Ping pings the underlying backend if it implements easykv.Pinger.
+func (c *Client) Ping(ctx context.Context) error {
+	if p, ok := c.rw.(easykv.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+// backend counts the GetValues calls and fires WatchPrefix on every change.
+type backend struct {
+	mu      sync.Mutex
+	values  map[string]string
+	gets    int
+	changed chan struct{}
+	watch   bool
+	watches int   // WatchPrefix calls
+	fail    error // returned by the next WatchPrefix
+	closed  bool
+
+	// hold blocks the next GetValues after it read the values until it is closed
+	hold    chan struct{}
+	blocked chan struct{}
+}
+
+func newBackend(watch bool) *backend {
+	return &backend{
+		values:  map[string]string{"/app/port": "80"},
+		changed: make(chan struct{}),
+		watch:   watch,
+	}
+}
+
+func (b *backend) GetValues(keys []string) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.gets++
+	vars := make(map[string]string)
+	for k, v := range b.values {
+		vars[k] = v
+	}
+	if hold := b.hold; hold != nil {
+		b.hold = nil
+		b.mu.Unlock()
+		close(b.blocked)
+		<-hold
+		b.mu.Lock()
+	}
+	return vars, nil
+}
+
+func (b *backend) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	b.mu.Lock()
+	b.watches++
+	fail := b.fail
+	b.fail = nil
+	b.mu.Unlock()
+	if !b.watch {
+		return 0, easykv.ErrWatchNotSupported
+	}
+	if fail != nil {
+		return 0, fail
+	}
+	select {
+	case <-b.changed:
+		return 1, nil
+	case <-ctx.Done():
+		return 0, easykv.ErrWatchCanceled
+	}
+}
+
+func (b *backend) Close() { b.closed = true }
+
+func (b *backend) set(key, value string) {
+	b.mu.Lock()
+	b.values[key] = value
+	b.mu.Unlock()
+	b.changed <- struct{}{}
+}
+
+func (b *backend) getCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.gets
+}
+
+func (b *backend) watchCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.watches
+}
+
+func (s *FilterSuite) TestWatched(t *C) {
+	b := newBackend(true)
+	c := New(b)
+
+	for i := 0; i < 3; i++ {
+		vals, err := c.GetValues([]string{"/app"})
+		t.Assert(err, IsNil)
+		t.Check(vals["/app/port"], Equals, "80")
+	}
+	t.Check(b.getCount(), Equals, 1)
+
+	b.set("/app/port", "8080")
+	for i := 0; i < 100 && c.Stats().Refreshes == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	vals, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(vals["/app/port"], Equals, "8080")
+
+	stats := c.Stats()
+	t.Check(stats.Hits, Equals, uint64(3))
+	t.Check(stats.Misses, Equals, uint64(1))
+	t.Check(stats.Refreshes, Equals, uint64(1))
+	t.Check(stats.Entries, Equals, 1)
+	t.Check(stats.Watching, Equals, 1)
+	t.Check(stats.HitRate(), Equals, 0.75)
+
+	c.Close()
+	t.Check(b.closed, Equals, true)
+}
+
+func (s *FilterSuite) TestTTL(t *C) {
+	b := newBackend(false)
+	c := New(b, WithTTL(50*time.Millisecond))
+	defer c.Close()
+
+	_, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	_, err = c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(b.getCount(), Equals, 1)
+
+	time.Sleep(100 * time.Millisecond)
+	stats := c.Stats()
+	t.Check(stats.Watching, Equals, 0)
+	t.Check(stats.Staleness >= 100*time.Millisecond, Equals, true)
+
+	_, err = c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(b.getCount(), Equals, 2)
+
+	// the backend isn't asked for a watch again
+	_, err = c.GetValues([]string{"/other"})
+	t.Assert(err, IsNil)
+	time.Sleep(10 * time.Millisecond)
+	t.Check(b.watchCount(), Equals, 1)
+}
+
+func (s *FilterSuite) TestWatchRetry(t *C) {
+	b := newBackend(true)
+	b.fail = easykv.ErrUnavailable
+	c := New(b)
+	defer c.Close()
+
+	_, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	for i := 0; i < 100 && b.watchCount() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Check(c.Stats().Watching, Equals, 1)
+
+	// the watch was started again after the failure
+	b.set("/app/port", "8080")
+	for i := 0; i < 100 && c.Stats().Refreshes == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	vals, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(vals["/app/port"], Equals, "8080")
+}
+
+func (s *FilterSuite) TestGetValuesContext(t *C) {
+	b := newBackend(true)
+	c := New(b)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.GetValuesContext(ctx, []string{"/app"})
+	t.Check(err, Equals, context.Canceled)
+}
+
+func (s *FilterSuite) TestWatchedTTL(t *C) {
+	b := newBackend(true)
+	c := New(b, WithTTL(50*time.Millisecond))
+	defer c.Close()
+
+	_, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+
+	// a change the watch doesn't report, like one between the fetch and the start of the watch
+	b.mu.Lock()
+	b.values["/app/port"] = "8080"
+	b.mu.Unlock()
+
+	time.Sleep(100 * time.Millisecond)
+	vals, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(vals["/app/port"], Equals, "8080")
+	t.Check(c.Stats().Watching, Equals, 1)
+}
+
+func (s *FilterSuite) TestFetchRace(t *C) {
+	b := newBackend(true)
+	c := New(b, WithTTL(50*time.Millisecond))
+	defer c.Close()
+
+	_, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	time.Sleep(100 * time.Millisecond)
+
+	// the expired values are fetched again, but the fetch is slow
+	hold := make(chan struct{})
+	b.mu.Lock()
+	b.hold, b.blocked = hold, make(chan struct{})
+	blocked := b.blocked
+	b.mu.Unlock()
+	done := make(chan map[string]string)
+	go func() {
+		vals, _ := c.GetValues([]string{"/app"})
+		done <- vals
+	}()
+	<-blocked
+
+	// the refresh after the change finishes first
+	b.set("/app/port", "8080")
+	for i := 0; i < 100 && c.Stats().Refreshes == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Assert(c.Stats().Refreshes, Equals, uint64(1))
+
+	close(hold)
+	// the slow fetch returns the newer values instead of overwriting them
+	t.Check((<-done)["/app/port"], Equals, "8080")
+	c.mu.Lock()
+	t.Check(c.entries["/app"].values["/app/port"], Equals, "8080")
+	c.mu.Unlock()
+}
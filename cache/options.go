@@ -0,0 +1,22 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package cache
+
+import "time"
+
+// Option configures the cache client.
+type Option func(*Client)
+
+// WithTTL sets how long the values of a prefix are served from memory (default: 1 minute).
+// Watched prefixes are refreshed on every change in between.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.ttl = ttl
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+// Capabilities are the optional features of a backend instance.
+type Capabilities struct {
+	// Watch is set if WatchPrefix doesn't return ErrWatchNotSupported.
+	Watch bool
+	// Write is set if the Writer methods don't return ErrWriteNotSupported.
+	Write bool
+	// TTL is set if SetWithTTL is supported.
+	TTL bool
+	// Transactions is set if CompareAndSwap and Commit are supported.
+	Transactions bool
+	// Revisions is set if GetEntries reports the revisions of the keys.
+	Revisions bool
+	// BinaryValues is set if values may contain arbitrary bytes instead of text only.
+	BinaryValues bool
+}
+
+// A CapabilityReporter - can report the features it supports
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf returns the Capabilities of rw.
+// They are reported by rw if it implements CapabilityReporter, which all backends of easyKV do.
+// Otherwise they are derived from the interfaces rw implements: a watch is assumed to be supported
+// and binary values are not.
+func CapabilitiesOf(rw ReadWatcher) Capabilities {
+	if r, ok := rw.(CapabilityReporter); ok {
+		return r.Capabilities()
+	}
+
+	var caps Capabilities
+	caps.Watch = true
+	_, caps.Write = rw.(Writer)
+	_, caps.TTL = rw.(TTLWriter)
+	_, caps.Transactions = rw.(Txn)
+	_, caps.Revisions = rw.(EntryReader)
+	return caps
+}
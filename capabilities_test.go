@@ -0,0 +1,47 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+
+	. "gopkg.in/check.v1"
+)
+
+type writableLayer struct {
+	*layer
+}
+
+func (l writableLayer) Set(ctx context.Context, key, value string) error      { return nil }
+func (l writableLayer) Delete(ctx context.Context, key string) error          { return nil }
+func (l writableLayer) DeletePrefix(ctx context.Context, prefix string) error { return nil }
+
+type reportingLayer struct {
+	*layer
+	caps Capabilities
+}
+
+func (l reportingLayer) Capabilities() Capabilities { return l.caps }
+
+func (s *FilterSuite) TestCapabilitiesOf(t *C) {
+	t.Check(CapabilitiesOf(newLayer(nil)), Equals, Capabilities{Watch: true})
+	t.Check(CapabilitiesOf(writableLayer{newLayer(nil)}), Equals, Capabilities{Watch: true, Write: true})
+
+	caps := Capabilities{Write: true, BinaryValues: true}
+	t.Check(CapabilitiesOf(reportingLayer{newLayer(nil), caps}), Equals, caps)
+}
+
+func (s *FilterSuite) TestLayeredCapabilities(t *C) {
+	noWatch := reportingLayer{newLayer(nil), Capabilities{Write: true, BinaryValues: true}}
+	binary := reportingLayer{newLayer(nil), Capabilities{Watch: true, BinaryValues: true}}
+
+	t.Check(CapabilitiesOf(Layered(noWatch, binary)), Equals, Capabilities{Watch: true, BinaryValues: true})
+	t.Check(CapabilitiesOf(Layered(noWatch, newLayer(nil))), Equals, Capabilities{Watch: true})
+	t.Check(CapabilitiesOf(Layered(noWatch)), Equals, Capabilities{BinaryValues: true})
+}
@@ -10,7 +10,10 @@
 
 package easykv
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // WatchOptions represents options for watch operations
 type WatchOptions struct {
@@ -41,3 +44,172 @@ type ReadWatcher interface {
 	WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (uint64, error)
 	Close()
 }
+
+// A ContextReader - can get values honouring the deadline and cancellation of ctx
+type ContextReader interface {
+	GetValuesContext(ctx context.Context, keys []string) (map[string]string, error)
+}
+
+// GetValuesContext calls the GetValuesContext method of rw if it implements ContextReader.
+// Otherwise ctx is only checked before GetValues is called.
+func GetValuesContext(ctx context.Context, rw ReadWatcher, keys []string) (map[string]string, error) {
+	if cr, ok := rw.(ContextReader); ok {
+		return cr.GetValuesContext(ctx, keys)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rw.GetValues(keys)
+}
+
+// A Writer - can set and delete keys
+type Writer interface {
+	Set(ctx context.Context, key, value string) error
+	Delete(ctx context.Context, key string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// A ReadWriteWatcher - can get, set and delete values and watch a prefix for changes
+type ReadWriteWatcher interface {
+	ReadWatcher
+	Writer
+}
+
+// EventType is the kind of change an Event reports
+type EventType int
+
+const (
+	// EventPut is reported if a key was created or updated
+	EventPut EventType = iota + 1
+	// EventDelete is reported if a key was deleted
+	EventDelete
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPut:
+		return "put"
+	case EventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// Event describes a single change of a key.
+// If the watch fails, a last Event with Err set is sent before the channel is closed.
+type Event struct {
+	Key      string
+	Value    string
+	Type     EventType
+	Revision uint64
+	Err      error
+}
+
+// An EventWatcher - can stream the changes below a prefix
+//
+// Watch reports every change below prefix on the returned channel until ctx is done.
+// WithKeys filters the reported keys, if no keys are given all changes below prefix are reported.
+// WithWaitIndex resumes the watch after the given revision if the backend supports it.
+type EventWatcher interface {
+	Watch(ctx context.Context, prefix string, opts ...WatchOption) (<-chan Event, error)
+}
+
+// Entry is a key with its value and the metadata the backend keeps for it.
+// Metadata the backend doesn't know is left zero.
+type Entry struct {
+	Key   string
+	Value []byte
+
+	// Revision is the revision (or index) of the last modification of the key.
+	Revision uint64
+	// CreateRevision is the revision of the creation of the key.
+	CreateRevision uint64
+	// Version counts the modifications of the key, starting with 1 on creation.
+	Version uint64
+	// ModifyTime is the time of the last modification.
+	ModifyTime time.Time
+	// TTL is the remaining time to live of the key.
+	TTL time.Duration
+	// Lease is the lease or session the key is bound to.
+	Lease string
+	// Flags are opaque flags stored with the key.
+	Flags uint64
+}
+
+// An EntryReader - can get values together with their metadata
+//
+// GetEntries returns the entries of all keys with one of the prefixes in keys, sorted by key.
+type EntryReader interface {
+	GetEntries(ctx context.Context, keys []string) ([]Entry, error)
+}
+
+// Snapshot is the state of several prefixes at a single revision.
+type Snapshot struct {
+	// Revision is the revision (or index) the snapshot was taken at.
+	Revision uint64
+	Values   map[string]string
+}
+
+// A SnapshotReader - can get the values of several prefixes at a single revision
+//
+// Unlike GetValues, GetSnapshot never returns a state where only a part of a concurrent update is visible.
+type SnapshotReader interface {
+	GetSnapshot(ctx context.Context, keys []string) (Snapshot, error)
+}
+
+// Compare is a condition of a transaction: Key has to be at Revision,
+// the revision GetEntries reports for it. Revision 0 means that Key must not exist.
+type Compare struct {
+	Key      string
+	Revision uint64
+}
+
+// TxnOp is a single write of a transaction.
+type TxnOp struct {
+	Key    string
+	Value  string
+	Delete bool
+}
+
+// PutOp returns a TxnOp that sets the value of key.
+func PutOp(key, value string) TxnOp {
+	return TxnOp{Key: key, Value: value}
+}
+
+// DeleteOp returns a TxnOp that removes key.
+func DeleteOp(key string) TxnOp {
+	return TxnOp{Key: key, Delete: true}
+}
+
+// A Txn - can update keys conditionally
+//
+// CompareAndSwap sets the value of key if it is still at revision.
+// Commit applies all ops atomically if all cmps hold.
+// Both return a *ConflictError if a compare fails.
+type Txn interface {
+	CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error
+	Commit(ctx context.Context, cmps []Compare, ops []TxnOp) error
+}
+
+// Lease keeps the keys of SetWithTTL alive.
+type Lease interface {
+	// Done is closed when the lease ended, either because it was closed
+	// or because it couldn't be kept alive. The keys expire afterwards.
+	Done() <-chan struct{}
+	// Close releases the lease early, which removes its keys.
+	Close() error
+}
+
+// A TTLWriter - can set keys that are removed if they aren't kept alive
+//
+// SetWithTTL sets the value of key and keeps it alive in the background until the returned Lease is closed.
+// If the process dies, the key is removed by the backend after ttl.
+// A ttl that isn't positive is rejected with an error marked as ErrInvalid.
+type TTLWriter interface {
+	SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (Lease, error)
+}
+
+// A Pinger - can check whether the backend is reachable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,217 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+// Package config keeps a typed configuration up to date with the values below a prefix.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/HeavyHorst/easykv/poll"
+)
+
+// Config holds the current configuration decoded from the values below a prefix.
+//
+// Load decodes the values once, Run keeps the configuration up to date by watching the prefix.
+// A new configuration is only stored if all validators accept it, otherwise the previous one is kept.
+type Config[T any] struct {
+	rw      easykv.ReadWatcher
+	prefix  string
+	options Options
+
+	current atomic.Pointer[T]
+
+	loads  atomic.Uint64 // sequence number of the last started load
+	loadMu sync.Mutex    // protects stored, so an older configuration can't replace a newer one
+	stored uint64        // sequence number of the load of the current configuration
+
+	mu         sync.Mutex // protects the hooks
+	validators []func(*T) error
+	onChange   []func(old, new *T)
+}
+
+// rejectedError marks errors that won't go away by loading the same values again.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// New returns a *config.Config for the values of rw below prefix.
+// The configuration is empty until Load or Run is called.
+func New[T any](rw easykv.ReadWatcher, prefix string, opts ...Option) *Config[T] {
+	options := Options{
+		MinBackoff:   time.Second,
+		MaxBackoff:   time.Minute,
+		PollInterval: poll.DefaultInterval,
+	}
+	for _, o := range opts {
+		o(&options)
+	}
+	return &Config[T]{
+		rw:      rw,
+		prefix:  prefix,
+		options: options,
+	}
+}
+
+// Get returns the current configuration, or nil if none was loaded yet.
+// The returned value must not be modified.
+func (c *Config[T]) Get() *T {
+	return c.current.Load()
+}
+
+// Validate registers fn to check every new configuration.
+// If fn returns an error, the new configuration is rejected and the previous one is kept.
+func (c *Config[T]) Validate(fn func(*T) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.validators = append(c.validators, fn)
+}
+
+// OnChange registers fn to be called after a new configuration was stored.
+// old is nil for the first configuration. fn may register hooks and call Load.
+func (c *Config[T]) OnChange(fn func(old, new *T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onChange = append(c.onChange, fn)
+}
+
+// Load gets the values below the prefix, decodes and validates them and stores the new configuration.
+// Concurrent loads may overlap, the configuration of the load that started last is kept.
+func (c *Config[T]) Load(ctx context.Context) error {
+	seq := c.loads.Add(1)
+	values, err := easykv.GetValuesContext(ctx, c.rw, []string{c.prefix})
+	if err != nil {
+		return err
+	}
+
+	next := new(T)
+	if err := easykv.Decode(values, c.prefix, next); err != nil {
+		var decodeErr *easykv.DecodeError
+		if !errors.As(err, &decodeErr) || len(decodeErr.Invalid) > 0 || c.options.Strict {
+			return &rejectedError{err}
+		}
+	}
+
+	// the hooks run without c.mu, so they can register further hooks
+	c.mu.Lock()
+	validators := append([]func(*T) error{}, c.validators...)
+	onChange := append([]func(old, new *T){}, c.onChange...)
+	c.mu.Unlock()
+
+	for _, validate := range validators {
+		if err := validate(next); err != nil {
+			return &rejectedError{fmt.Errorf("config rejected: %w", err)}
+		}
+	}
+
+	c.loadMu.Lock()
+	if seq < c.stored {
+		// a load that started later stored its configuration already
+		c.loadMu.Unlock()
+		return nil
+	}
+	c.stored = seq
+	old := c.current.Swap(next)
+	c.loadMu.Unlock()
+
+	for _, fn := range onChange {
+		fn(old, next)
+	}
+	return nil
+}
+
+// Run loads the configuration and reloads it whenever the values below the prefix change, until ctx is done.
+// Backends without watch support are polled.
+// Failed watches and loads are retried with an increasing backoff, rejected configurations
+// are kept until the values change again. Run returns the error of ctx.
+func (c *Config[T]) Run(ctx context.Context) error {
+	rw := c.rw
+	var waitIndex uint64
+	backoff := time.Duration(0)
+	reload := true
+
+	for {
+		if reload {
+			err := c.Load(ctx)
+			var rejected *rejectedError
+			switch {
+			case ctx.Err() != nil:
+				return ctx.Err()
+			case err == nil, errors.As(err, &rejected):
+				// the values must change to get a different result
+				reload = false
+				backoff = 0
+			}
+			if err != nil {
+				c.handleError(err)
+			}
+			if reload {
+				if !c.sleep(ctx, &backoff) {
+					return ctx.Err()
+				}
+				continue
+			}
+		}
+
+		index, err := rw.WatchPrefix(ctx, c.prefix, easykv.WithKeys([]string{c.prefix}), easykv.WithWaitIndex(waitIndex))
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, easykv.ErrWatchNotSupported) && rw == c.rw {
+			rw = poll.New(c.rw, poll.WithInterval(c.options.PollInterval))
+			continue
+		}
+		if err != nil {
+			c.handleError(err)
+			// changes may have been missed
+			waitIndex = 0
+			reload = true
+			if !c.sleep(ctx, &backoff) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		waitIndex = index
+		reload = true
+	}
+}
+
+// sleep waits for the backoff and doubles it for the next failure.
+// It returns false if ctx is done first.
+func (c *Config[T]) sleep(ctx context.Context, backoff *time.Duration) bool {
+	if *backoff == 0 {
+		*backoff = c.options.MinBackoff
+	} else if *backoff *= 2; *backoff > c.options.MaxBackoff {
+		*backoff = c.options.MaxBackoff
+	}
+
+	t := time.NewTimer(*backoff)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (c *Config[T]) handleError(err error) {
+	if c.options.ErrorHandler != nil {
+		c.options.ErrorHandler(err)
+	}
+}
@@ -0,0 +1,287 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/HeavyHorst/easykv/memkv"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+type testConfig struct {
+	URL     string        `easykv:"url"`
+	Port    int           `easykv:"port"`
+	Timeout time.Duration `easykv:"timeout"`
+}
+
+// noWatch hides the watches of the memkv backend.
+type noWatch struct {
+	*memkv.Client
+}
+
+func (n noWatch) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	return 0, easykv.ErrWatchNotSupported
+}
+
+func newBackend(t *C) *memkv.Client {
+	c, err := memkv.New(map[string]string{
+		"/app/url":     "www.google.de",
+		"/app/port":    "80",
+		"/app/timeout": "5s",
+		"/app/unknown": "ignored",
+	})
+	t.Assert(err, IsNil)
+	return c
+}
+
+type change struct {
+	old, new *testConfig
+}
+
+func (s *FilterSuite) TestLoad(t *C) {
+	c := New[testConfig](newBackend(t), "/app")
+	t.Check(c.Get(), IsNil)
+
+	t.Assert(c.Load(context.Background()), IsNil)
+	t.Check(*c.Get(), Equals, testConfig{URL: "www.google.de", Port: 80, Timeout: 5 * time.Second})
+
+	strict := New[testConfig](newBackend(t), "/app", WithStrict())
+	var decodeErr *easykv.DecodeError
+	t.Check(errors.As(strict.Load(context.Background()), &decodeErr), Equals, true)
+	t.Check(strict.Get(), IsNil)
+}
+
+func (s *FilterSuite) TestRun(t *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := newBackend(t)
+
+	c := New[testConfig](backend, "/app")
+	changes := make(chan change, 10)
+	c.OnChange(func(old, new *testConfig) {
+		changes <- change{old, new}
+	})
+	c.Validate(func(cfg *testConfig) error {
+		if cfg.Port == 0 {
+			return errors.New("port is required")
+		}
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	next := func() change {
+		select {
+		case ch := <-changes:
+			return ch
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for a change")
+		}
+		return change{}
+	}
+
+	ch := next()
+	t.Check(ch.old, IsNil)
+	t.Check(ch.new.Port, Equals, 80)
+
+	t.Assert(backend.Set(ctx, "/app/port", "8080"), IsNil)
+	ch = next()
+	t.Check(ch.old.Port, Equals, 80)
+	t.Check(ch.new.Port, Equals, 8080)
+	t.Check(c.Get(), Equals, ch.new)
+
+	// rejected configs keep the previous one
+	t.Assert(backend.Set(ctx, "/app/port", "0"), IsNil)
+	t.Assert(backend.Set(ctx, "/app/port", "invalid"), IsNil)
+	t.Assert(backend.Set(ctx, "/app/url", "www.google.com"), IsNil)
+	t.Assert(backend.Set(ctx, "/app/port", "9090"), IsNil)
+	ch = next()
+	t.Check(ch.old.Port, Equals, 8080)
+	t.Check(ch.new, DeepEquals, &testConfig{URL: "www.google.com", Port: 9090, Timeout: 5 * time.Second})
+
+	cancel()
+	t.Check(<-done, Equals, context.Canceled)
+}
+
+func (s *FilterSuite) TestRunPoll(t *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := newBackend(t)
+
+	c := New[testConfig](noWatch{backend}, "/app", WithPollInterval(10*time.Millisecond))
+	changes := make(chan *testConfig, 10)
+	c.OnChange(func(old, new *testConfig) {
+		changes <- new
+	})
+	go c.Run(ctx)
+
+	t.Check((<-changes).Port, Equals, 80)
+	t.Assert(backend.Set(ctx, "/app/port", "8080"), IsNil)
+	select {
+	case cfg := <-changes:
+		t.Check(cfg.Port, Equals, 8080)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for a change")
+	}
+}
+
+// failing fails every GetValues call until it is fixed.
+type failing struct {
+	*memkv.Client
+	fail chan bool
+}
+
+func (f failing) GetValues(keys []string) (map[string]string, error) {
+	return f.GetValuesContext(context.Background(), keys)
+}
+
+func (f failing) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	select {
+	case <-f.fail:
+		return nil, easykv.ErrUnavailable
+	default:
+		return f.Client.GetValuesContext(ctx, keys)
+	}
+}
+
+func (s *FilterSuite) TestRunBackoff(t *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	backend := failing{newBackend(t), make(chan bool, 2)}
+	backend.fail <- true
+	backend.fail <- true
+
+	errs := make(chan error, 10)
+	c := New[testConfig](backend, "/app", WithBackoff(time.Millisecond, 10*time.Millisecond), WithErrorHandler(func(err error) {
+		errs <- err
+	}))
+	changes := make(chan *testConfig, 10)
+	c.OnChange(func(old, new *testConfig) {
+		changes <- new
+	})
+	go c.Run(ctx)
+
+	select {
+	case cfg := <-changes:
+		t.Check(cfg.Port, Equals, 80)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the config")
+	}
+	t.Check(errors.Is(<-errs, easykv.ErrUnavailable), Equals, true)
+	t.Check(errors.Is(<-errs, easykv.ErrUnavailable), Equals, true)
+}
+
+// gated blocks the GetValues calls after reading the values until a value is sent on release.
+type gated struct {
+	*memkv.Client
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (g gated) GetValues(keys []string) (map[string]string, error) {
+	return g.GetValuesContext(context.Background(), keys)
+}
+
+func (g gated) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	values, err := g.Client.GetValuesContext(ctx, keys)
+	g.read <- struct{}{}
+	<-g.release
+	return values, err
+}
+
+func (s *FilterSuite) TestLoadConcurrent(t *C) {
+	backend := gated{newBackend(t), make(chan struct{}), make(chan struct{})}
+	c := New[testConfig](backend, "/app")
+	ctx := context.Background()
+
+	first := make(chan error)
+	go func() { first <- c.Load(ctx) }()
+	<-backend.read
+
+	// the second load starts after a change, while the first one still holds the old values
+	t.Assert(backend.Set(ctx, "/app/port", "8080"), IsNil)
+	second := make(chan error)
+	go func() { second <- c.Load(ctx) }()
+
+	// the second one may finish first, it must not be overwritten by the first one
+	secondRead := false
+	select {
+	case <-backend.read:
+		secondRead = true
+		backend.release <- struct{}{}
+	case <-time.After(50 * time.Millisecond):
+	}
+	backend.release <- struct{}{}
+	t.Assert(<-first, IsNil)
+	if !secondRead {
+		<-backend.read
+		backend.release <- struct{}{}
+	}
+	t.Assert(<-second, IsNil)
+	t.Check(c.Get().Port, Equals, 8080)
+}
+
+func (s *FilterSuite) TestHooksReentrant(t *C) {
+	c := New[testConfig](newBackend(t), "/app")
+	var calls int
+	c.Validate(func(cfg *testConfig) error {
+		c.Validate(func(*testConfig) error { return nil })
+		return nil
+	})
+	c.OnChange(func(old, new *testConfig) {
+		calls++
+		c.OnChange(func(old, new *testConfig) {})
+	})
+
+	done := make(chan error)
+	go func() { done <- c.Load(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Check(err, IsNil)
+	case <-time.After(time.Second):
+		t.Fatal("a hook that registers another hook deadlocked")
+	}
+	t.Check(calls, Equals, 1)
+}
+
+func (s *FilterSuite) TestOnChangeLoad(t *C) {
+	c := New[testConfig](newBackend(t), "/app")
+	var calls int
+	c.OnChange(func(old, new *testConfig) {
+		calls++
+		if old == nil {
+			// the hook loads the configuration again
+			t.Check(c.Load(context.Background()), IsNil)
+		}
+	})
+
+	done := make(chan error)
+	go func() { done <- c.Load(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Check(err, IsNil)
+	case <-time.After(time.Second):
+		t.Fatal("a hook that calls Load deadlocked")
+	}
+	t.Check(calls, Equals, 2)
+}
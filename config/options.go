@@ -0,0 +1,54 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package config
+
+import "time"
+
+// Options contains the settings of the reload loop.
+type Options struct {
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	Strict       bool
+	ErrorHandler func(error)
+}
+
+// Option configures the config.
+type Option func(*Options)
+
+// WithBackoff sets the wait time after a failed watch or load.
+// It starts at min and doubles with every failure up to max (default: 1 second to 1 minute).
+func WithBackoff(min, max time.Duration) Option {
+	return func(o *Options) {
+		o.MinBackoff = min
+		o.MaxBackoff = max
+	}
+}
+
+// WithPollInterval sets the poll interval for backends without watch support (default: poll.DefaultInterval).
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.PollInterval = interval
+	}
+}
+
+// WithStrict rejects configs with keys that don't match a field.
+// By default such keys are ignored.
+func WithStrict() Option {
+	return func(o *Options) {
+		o.Strict = true
+	}
+}
+
+// WithErrorHandler sets a function that is called with every error of the reload loop.
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *Options) {
+		o.ErrorHandler = fn
+	}
+}
@@ -16,8 +16,12 @@ package consul
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/HeavyHorst/easykv"
 	"github.com/hashicorp/consul/api"
@@ -25,7 +29,10 @@ import (
 
 // Client is a wrapper around the consul KV-client.
 type Client struct {
-	client *api.KV
+	client  *api.KV
+	session *api.Session
+	consul  *api.Client
+	logger  *slog.Logger
 }
 
 // New returns a new client to Consul for the given address.
@@ -59,7 +66,9 @@ func New(nodes []string, opts ...Option) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Client{client.KV()}, nil
+	logger := easykv.BackendLogger(options.Logger, "consul")
+	logger.Debug("client created", "address", conf.Address)
+	return &Client{client.KV(), client.Session(), client, logger}, nil
 }
 
 // Close is only meant to fulfill the easykv.ReadWatcher interface.
@@ -69,12 +78,17 @@ func (c *Client) Close() {}
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests are bound to ctx.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	vars := make(map[string]string)
 	for _, key := range keys {
 		key := strings.TrimPrefix(key, "/")
-		pairs, _, err := c.client.List(key, nil)
+		pairs, _, err := c.client.List(key, (&api.QueryOptions{}).WithContext(ctx))
 		if err != nil {
-			return vars, err
+			return vars, wrapError(err)
 		}
 		for _, p := range pairs {
 			vars[path.Join("/", p.Key)] = string(p.Value)
@@ -83,18 +97,194 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 	return vars, nil
 }
 
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+// Keys that are locked by a session have the session id as Lease.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	entries := make(map[string]easykv.Entry)
+	for _, key := range keys {
+		key := strings.TrimPrefix(key, "/")
+		pairs, _, err := c.client.List(key, (&api.QueryOptions{}).WithContext(ctx))
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		for _, p := range pairs {
+			e := easykv.Entry{
+				Key:            path.Join("/", p.Key),
+				Value:          p.Value,
+				Revision:       p.ModifyIndex,
+				CreateRevision: p.CreateIndex,
+				Lease:          p.Session,
+				Flags:          p.Flags,
+			}
+			entries[e.Key] = e
+		}
+	}
+
+	list := make([]easykv.Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// GetSnapshot returns the values of all prefixes in keys at a single index.
+// All prefixes are read in one transaction, which is limited to 64 prefixes by consul.
+func (c *Client) GetSnapshot(ctx context.Context, keys []string) (easykv.Snapshot, error) {
+	ops := make(api.KVTxnOps, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVGetTree, Key: strings.TrimPrefix(key, "/")})
+	}
+
+	ok, resp, meta, err := c.client.Txn(ops, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return easykv.Snapshot{}, wrapError(err)
+	}
+	if !ok {
+		var errs []string
+		for _, e := range resp.Errors {
+			errs = append(errs, e.What)
+		}
+		return easykv.Snapshot{}, fmt.Errorf("transaction failed: %s", strings.Join(errs, ", "))
+	}
+
+	snap := easykv.Snapshot{Revision: meta.LastIndex, Values: make(map[string]string)}
+	for _, p := range resp.Results {
+		snap.Values[path.Join("/", p.Key)] = string(p.Value)
+	}
+	return snap, nil
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	p := &api.KVPair{Key: strings.TrimPrefix(key, "/"), Value: []byte(value)}
+	_, err := c.client.Put(p, (&api.WriteOptions{}).WithContext(ctx))
+	return wrapError(err)
+}
+
+// MinTTL is the shortest session TTL consul accepts, shorter TTLs are raised to it.
+const MinTTL = 10 * time.Second
+
+// SetWithTTL acquires key with a new session with ttl and the delete behavior.
+// The session is renewed until the lease is closed, closing the lease destroys the session which removes the key.
+// A *easykv.ConflictError is returned if key is held by another session.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	if ttl < MinTTL {
+		ttl = MinTTL
+	}
+	entry := &api.SessionEntry{
+		TTL:       ttl.String(),
+		Behavior:  api.SessionBehaviorDelete,
+		LockDelay: time.Millisecond,
+	}
+	id, _, err := c.session.Create(entry, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	p := &api.KVPair{Key: strings.TrimPrefix(key, "/"), Value: []byte(value), Session: id}
+	ok, _, err := c.client.Acquire(p, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil || !ok {
+		c.session.Destroy(id, nil)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		return nil, &easykv.ConflictError{Key: key}
+	}
+
+	refresh := func(ctx context.Context) error {
+		entry, _, err := c.session.Renew(id, (&api.WriteOptions{}).WithContext(ctx))
+		if err == nil && entry == nil {
+			return easykv.WrapError(easykv.ErrKeyNotFound, api.ErrSessionExpired)
+		}
+		return wrapError(err)
+	}
+	release := func(ctx context.Context) error {
+		_, err := c.session.Destroy(id, (&api.WriteOptions{}).WithContext(ctx))
+		return wrapError(err)
+	}
+	return easykv.NewLease(ttl, refresh, release), nil
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.Delete(strings.TrimPrefix(key, "/"), (&api.WriteOptions{}).WithContext(ctx))
+	return wrapError(err)
+}
+
+// DeletePrefix removes all keys with the given prefix.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	_, err := c.client.DeleteTree(strings.TrimPrefix(prefix, "/"), (&api.WriteOptions{}).WithContext(ctx))
+	return wrapError(err)
+}
+
 type watchResponse struct {
 	waitIndex uint64
 	err       error
 }
 
+// CompareAndSwap sets the value of key if its ModifyIndex is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	p := &api.KVPair{Key: strings.TrimPrefix(key, "/"), Value: []byte(value), ModifyIndex: revision}
+	ok, _, err := c.client.CAS(p, (&api.WriteOptions{}).WithContext(ctx))
+	if err != nil {
+		return wrapError(err)
+	}
+	if !ok {
+		return &easykv.ConflictError{Key: key}
+	}
+	return nil
+}
+
+// Commit applies all ops in one consul transaction if the ModifyIndexes of all cmps match.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	txn := make(api.KVTxnOps, 0, len(cmps)+len(ops))
+	for _, cmp := range cmps {
+		op := &api.KVTxnOp{Verb: api.KVCheckIndex, Key: strings.TrimPrefix(cmp.Key, "/"), Index: cmp.Revision}
+		if cmp.Revision == 0 {
+			op.Verb = api.KVCheckNotExists
+		}
+		txn = append(txn, op)
+	}
+	for _, op := range ops {
+		if op.Delete {
+			txn = append(txn, &api.KVTxnOp{Verb: api.KVDelete, Key: strings.TrimPrefix(op.Key, "/")})
+		} else {
+			txn = append(txn, &api.KVTxnOp{Verb: api.KVSet, Key: strings.TrimPrefix(op.Key, "/"), Value: []byte(op.Value)})
+		}
+	}
+
+	ok, resp, _, err := c.client.Txn(txn, (&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return wrapError(err)
+	}
+	if ok {
+		return nil
+	}
+
+	var errs []string
+	for _, e := range resp.Errors {
+		if e.OpIndex < len(cmps) {
+			return &easykv.ConflictError{Key: cmps[e.OpIndex].Key}
+		}
+		errs = append(errs, e.What)
+	}
+	return fmt.Errorf("transaction failed: %s", strings.Join(errs, ", "))
+}
+
 // WatchPrefix watches a specific prefix for changes.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	var options easykv.WatchOptions
 	for _, o := range opts {
 		o(&options)
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	respChan := make(chan watchResponse)
 	go func() {
 		opts := api.QueryOptions{
@@ -102,7 +292,7 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 		}
 		_, meta, err := c.client.List(prefix, &opts)
 		if err != nil {
-			respChan <- watchResponse{options.WaitIndex, err}
+			respChan <- watchResponse{options.WaitIndex, wrapError(err)}
 			return
 		}
 		respChan <- watchResponse{meta.LastIndex, err}
@@ -116,3 +306,20 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 		}
 	}
 }
+
+// Capabilities reports the features of consul.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Transactions: true, Revisions: true, BinaryValues: true}
+}
+
+// Ping asks the agent for the current raft leader, which fails if the cluster has none.
+func (c *Client) Ping(ctx context.Context) error {
+	leader, err := c.consul.Status().LeaderWithQueryOptions((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil {
+		return wrapError(err)
+	}
+	if leader == "" {
+		return easykv.WrapError(easykv.ErrUnavailable, fmt.Errorf("no cluster leader"))
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 	"github.com/hashicorp/consul/api"
 
@@ -27,6 +28,17 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+// WatchPrefix ignores WithKeys and returns the current index at once if the WaitIndex is 0
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New([]string{"localhost:8500"}, WithScheme("http"))
+		t.Assert(err, IsNil)
+		return c
+	},
+	LooseKeys:    true,
+	InitialIndex: true,
+})
+
 func (s *FilterSuite) TestGetValues(t *C) {
 	c, err := New([]string{"localhost:8500"}, WithScheme("http"))
 	if err != nil {
@@ -44,6 +56,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	c.client.Put(&api.KVPair{Key: "remtest/database/hosts/1/size", Value: []byte("80")}, nil)
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchPrefix(t *C) {
@@ -84,3 +97,51 @@ func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, err := New([]string{"localhost:8500"}, WithScheme("http"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestOpen(t *C) {
+	c, err := easykv.Open("consul://localhost:8500?tls-ca=")
+	t.Assert(err, IsNil)
+	defer c.Close()
+	t.Check(c, FitsTypeOf, &Client{})
+
+	// the path is the prefix of all keys
+	c2, err := easykv.Open("consul://localhost:8500/prefix?tls=false")
+	t.Assert(err, IsNil)
+	defer c2.Close()
+	t.Check(c2, Not(FitsTypeOf), &Client{})
+
+	_, err = easykv.Open("consul://localhost:8500?tsl=true")
+	t.Check(err, ErrorMatches, "unknown consul url parameters: tsl")
+	_, err = easykv.Open("consul://localhost:8500?tls=yes")
+	t.Check(err, NotNil)
+}
+
+func (s *FilterSuite) TestLock(t *C) {
+	c, err := New([]string{"localhost:8500"}, WithScheme("http"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Locker(t, c)
+}
+
+func (s *FilterSuite) TestElection(t *C) {
+	c, err := New([]string{"localhost:8500"}, WithScheme("http"))
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Elector(t, c)
+}
@@ -0,0 +1,35 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package consul
+
+import (
+	"strings"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+// wrapError marks the errors of the consul api with the easykv error kinds.
+// The api only reports the http status code in the error message.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Unexpected response code: 401"),
+		strings.Contains(msg, "Unexpected response code: 403"):
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	case strings.Contains(msg, "Unexpected response code: 404"):
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case strings.Contains(msg, "Unexpected response code: 5"):
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	}
+	return easykv.ClassifyError(err)
+}
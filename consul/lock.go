@@ -0,0 +1,153 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package consul
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv/lock"
+	"github.com/hashicorp/consul/api"
+)
+
+// closed is returned by Done if there is nothing to wait for.
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Lock acquires the lock key with an api.Lock, which holds the key with a new session.
+// The lock is lost if the session is invalidated.
+func (c *Client) Lock(ctx context.Context, key string) (lock.Lock, error) {
+	return c.acquire(ctx, key, nil)
+}
+
+// acquire blocks until the lock key is held with value or ctx is done.
+func (c *Client) acquire(ctx context.Context, key string, value []byte) (*mutex, error) {
+	l, err := c.consul.LockOpts(&api.LockOptions{Key: strings.TrimPrefix(key, "/"), Value: value})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	stop := make(chan struct{})
+	defer context.AfterFunc(ctx, func() { close(stop) })()
+	lost, err := l.Lock(stop)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if lost == nil {
+		// the stop channel was closed
+		return nil, ctx.Err()
+	}
+	return &mutex{lock: l, lost: lost}, nil
+}
+
+type mutex struct {
+	lock *api.Lock
+	lost <-chan struct{}
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	return wrapError(m.lock.Unlock())
+}
+
+func (m *mutex) Done() <-chan struct{} {
+	return m.lost
+}
+
+// Election returns a candidate for the election key.
+// The leader holds the key as a lock with its value.
+func (c *Client) Election(key string) lock.Election {
+	return &election{c: c, key: key}
+}
+
+type election struct {
+	c   *Client
+	key string
+
+	mu     sync.Mutex
+	leader *mutex // of the won campaign
+}
+
+func (e *election) Campaign(ctx context.Context, value string) error {
+	m, err := e.c.acquire(ctx, e.key, []byte(value))
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = m
+	return nil
+}
+
+func (e *election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader == nil {
+		return nil
+	}
+	err := e.leader.Unlock(ctx)
+	e.leader = nil
+	return err
+}
+
+func (e *election) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader == nil {
+		return closed
+	}
+	return e.leader.Done()
+}
+
+// Observe waits for changes of the election key with blocking queries.
+func (e *election) Observe(ctx context.Context) <-chan string {
+	leaders := make(chan string)
+	go func() {
+		defer close(leaders)
+		var index uint64
+		var current string // session and value of the last leader
+		for {
+			opts := api.QueryOptions{WaitIndex: index}
+			pair, meta, err := e.c.client.Get(strings.TrimPrefix(e.key, "/"), opts.WithContext(ctx))
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+			if meta.LastIndex < index {
+				// the index went backwards, start over
+				index = 0
+				continue
+			}
+			index = meta.LastIndex
+
+			if pair == nil || pair.Session == "" {
+				current = ""
+				continue
+			}
+			if leader := pair.Session + string(pair.Value); leader != current {
+				current = leader
+				select {
+				case leaders <- string(pair.Value):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return leaders
+}
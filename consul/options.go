@@ -8,10 +8,13 @@
 
 package consul
 
+import "log/slog"
+
 // Options contains all values that are needed to connect to consul.
 type Options struct {
 	Scheme string
 	TLS    TLSOptions
+	Logger *slog.Logger
 }
 
 // TLSOptions contains all certificates and keys.
@@ -37,3 +40,10 @@ func WithTLSOptions(tls TLSOptions) Option {
 		o.TLS = tls
 	}
 }
+
+// WithLogger sets the logger for watches, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package consul
+
+import (
+	"net/url"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("consul", open)
+}
+
+// open creates a client from an url like
+//
+//	consul://127.0.0.1:8500/prefix?tls=true&tls-cert=/client.pem&tls-key=/client.key&tls-ca=/ca.pem
+//
+// The path is the prefix of all keys, see easykv.Prefixed.
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	q, err := easykv.Query(u, "tls", "tls-cert", "tls-key", "tls-ca")
+	if err != nil {
+		return nil, err
+	}
+	tls, err := easykv.BoolParam(q, "tls")
+	if err != nil {
+		return nil, err
+	}
+	scheme := "http"
+	if tls {
+		scheme = "https"
+	}
+
+	c, err := New(easykv.Hosts(u), WithScheme(scheme), WithTLSOptions(TLSOptions{
+		ClientCert:   q.Get("tls-cert"),
+		ClientKey:    q.Get("tls-key"),
+		ClientCaKeys: q.Get("tls-ca"),
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return easykv.Prefixed(c, u.Path), nil
+}
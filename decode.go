@@ -0,0 +1,280 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyError is the error for a single key that couldn't be decoded.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %s: %v", e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeError reports all keys that Decode couldn't store.
+// The other keys are decoded anyway.
+type DecodeError struct {
+	// Unmapped are the keys without a matching field.
+	Unmapped []string
+	// Invalid are the keys whose values couldn't be converted to the type of their field.
+	Invalid []*KeyError
+}
+
+func (e *DecodeError) Error() string {
+	var parts []string
+	if len(e.Unmapped) > 0 {
+		parts = append(parts, fmt.Sprintf("unmapped keys: %s", strings.Join(e.Unmapped, ", ")))
+	}
+	for _, err := range e.Invalid {
+		parts = append(parts, err.Error())
+	}
+	return "easykv: decode: " + strings.Join(parts, "; ")
+}
+
+var errUnmapped = errors.New("no matching field")
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Load calls GetValues of rw for prefix and decodes the values into v.
+func Load(rw ReadWatcher, prefix string, v interface{}) error {
+	values, err := rw.GetValues([]string{prefix})
+	if err != nil {
+		return err
+	}
+	return Decode(values, prefix, v)
+}
+
+// Decode stores the values below prefix in v, which must be a non-nil pointer.
+//
+// The path segments of a key below prefix select the struct fields, map keys and slice indexes:
+// /app/database/hosts/0/ip is stored in cfg.Database.Hosts[0].IP for the prefix /app.
+// A struct field matches the segment in its `easykv:"name"` tag, without a tag the field name
+// is compared case-insensitively. Fields tagged with `easykv:"-"` are skipped, embedded structs without a tag are inlined.
+//
+// A slice grows to the largest index of its keys, which has to be smaller than the number of keys below prefix,
+// so a list can have gaps but keys from the store can't allocate huge slices.
+//
+// Values are converted to strings, bools, ints, uints, floats, time.Durations
+// and every type that implements encoding.TextUnmarshaler.
+// Keys that can't be stored are reported in a *DecodeError.
+func Decode(values map[string]string, prefix string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("easykv: decode: expected a non-nil pointer, got %T", v)
+	}
+
+	prefix = strings.TrimSuffix(prefix, "/")
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		if k == prefix || strings.HasPrefix(k, prefix+"/") {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var decodeErr DecodeError
+	for _, k := range keys {
+		var segments []string
+		if rel := strings.Trim(k[len(prefix):], "/"); rel != "" {
+			segments = strings.Split(rel, "/")
+		}
+
+		err := decodeValue(rv.Elem(), segments, values[k], len(keys))
+		switch {
+		case err == errUnmapped:
+			decodeErr.Unmapped = append(decodeErr.Unmapped, k)
+		case err != nil:
+			decodeErr.Invalid = append(decodeErr.Invalid, &KeyError{Key: k, Err: err})
+		}
+	}
+
+	if len(decodeErr.Unmapped) > 0 || len(decodeErr.Invalid) > 0 {
+		return &decodeErr
+	}
+	return nil
+}
+
+// decodeValue stores value in the element of v that is selected by segments.
+// Slices are grown to at most maxLen elements.
+func decodeValue(v reflect.Value, segments []string, value string, maxLen int) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeValue(v.Elem(), segments, value, maxLen)
+	}
+
+	if len(segments) == 0 {
+		return setValue(v, value)
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return errUnmapped
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		field, ok := structField(v, segments[0])
+		if !ok {
+			return errUnmapped
+		}
+		return decodeValue(field, segments[1:], value, maxLen)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported map key type %s", v.Type().Key())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.ValueOf(segments[0]).Convert(v.Type().Key())
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if old := v.MapIndex(key); old.IsValid() {
+			elem.Set(old)
+		}
+		if err := decodeValue(elem, segments[1:], value, maxLen); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+		return nil
+	case reflect.Slice:
+		i, err := strconv.Atoi(segments[0])
+		if err != nil || i < 0 {
+			return fmt.Errorf("invalid slice index %q", segments[0])
+		}
+		if i >= maxLen {
+			return fmt.Errorf("slice index %d out of range, there are only %d keys", i, maxLen)
+		}
+		if i >= v.Len() {
+			grown := reflect.MakeSlice(v.Type(), i+1, i+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return decodeValue(v.Index(i), segments[1:], value, maxLen)
+	case reflect.Array:
+		i, err := strconv.Atoi(segments[0])
+		if err != nil || i < 0 || i >= v.Len() {
+			return fmt.Errorf("invalid array index %q", segments[0])
+		}
+		return decodeValue(v.Index(i), segments[1:], value, maxLen)
+	}
+	return errUnmapped
+}
+
+// structField returns the field of the struct v that matches the path segment name.
+func structField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("easykv")
+		// the exported fields of an embedded unexported struct are still settable, unless it is a pointer
+		if tag == "-" || (f.PkgPath != "" && !(f.Anonymous && f.Type.Kind() == reflect.Struct)) {
+			continue
+		}
+
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				field := v.Field(i)
+				if field.Kind() == reflect.Ptr {
+					if field.IsNil() {
+						field.Set(reflect.New(ft))
+					}
+					field = field.Elem()
+				}
+				if inner, ok := structField(field, name); ok {
+					return inner, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if (tag != "" && tag == name) || (tag == "" && strings.EqualFold(f.Name, name)) {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setValue converts value to the type of v.
+func setValue(v reflect.Value, value string) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(value))
+		}
+	}
+
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		v.Set(reflect.ValueOf(value))
+	default:
+		return fmt.Errorf("a value can't be stored in a %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+type decodeHost struct {
+	Name string
+	IP   net.IP `easykv:"ip"`
+	Size int
+}
+
+type decodeBase struct {
+	Debug bool
+}
+
+type decodeConfig struct {
+	decodeBase
+	URL     string            `easykv:"url"`
+	User    string            `easykv:"user"`
+	Timeout time.Duration     `easykv:"timeout"`
+	Ratio   float64           `easykv:"ratio"`
+	Port    uint16            `easykv:"port"`
+	Hosts   []decodeHost      `easykv:"hosts"`
+	Labels  map[string]string `easykv:"labels"`
+	Backup  *decodeHost       `easykv:"backup"`
+	Ignored string            `easykv:"-"`
+}
+
+func (s *FilterSuite) TestDecode(t *C) {
+	values := map[string]string{
+		"/app/database/url":          "www.google.de",
+		"/app/database/user":         "Boris",
+		"/app/database/debug":        "true",
+		"/app/database/timeout":      "1m30s",
+		"/app/database/ratio":        "0.5",
+		"/app/database/port":         "5432",
+		"/app/database/hosts/0/name": "test1",
+		"/app/database/hosts/0/ip":   "192.168.0.1",
+		"/app/database/hosts/0/size": "60",
+		"/app/database/hosts/1/name": "test2",
+		"/app/database/labels/env":   "prod",
+		"/app/database/backup/name":  "backup1",
+		"/app/other":                 "not below the prefix",
+		"/app/databases/url":         "not below the prefix either",
+	}
+
+	var cfg decodeConfig
+	err := Decode(values, "/app/database", &cfg)
+	t.Assert(err, IsNil)
+	t.Check(cfg.URL, Equals, "www.google.de")
+	t.Check(cfg.User, Equals, "Boris")
+	t.Check(cfg.Debug, Equals, true)
+	t.Check(cfg.Timeout, Equals, 90*time.Second)
+	t.Check(cfg.Ratio, Equals, 0.5)
+	t.Check(cfg.Port, Equals, uint16(5432))
+	t.Assert(cfg.Hosts, HasLen, 2)
+	t.Check(cfg.Hosts[0].IP.String(), Equals, "192.168.0.1")
+	t.Check(cfg.Hosts[0].Size, Equals, 60)
+	t.Check(cfg.Hosts[1].Name, Equals, "test2")
+	t.Check(cfg.Labels, DeepEquals, map[string]string{"env": "prod"})
+	t.Assert(cfg.Backup, NotNil)
+	t.Check(cfg.Backup.Name, Equals, "backup1")
+}
+
+func (s *FilterSuite) TestDecodeMap(t *C) {
+	var m map[string][]string
+	err := Decode(map[string]string{
+		"/hosts/web/0": "a",
+		"/hosts/web/1": "b",
+		"/hosts/db/0":  "c",
+	}, "/hosts/", &m)
+	t.Assert(err, IsNil)
+	t.Check(m, DeepEquals, map[string][]string{"web": {"a", "b"}, "db": {"c"}})
+}
+
+func (s *FilterSuite) TestDecodeErrors(t *C) {
+	var cfg decodeConfig
+	err := Decode(map[string]string{
+		"/app/url":         "www.google.de",
+		"/app/unknown":     "x",
+		"/app/url/deeper":  "x",
+		"/app/ignored":     "x",
+		"/app/port":        "65536",
+		"/app/timeout":     "soon",
+		"/app/hosts/x/ip":  "192.168.0.1",
+		"/app/hosts/0/ip":  "not an ip",
+		"/app/hosts/0/age": "3",
+	}, "/app", &cfg)
+
+	var decodeErr *DecodeError
+	t.Assert(errors.As(err, &decodeErr), Equals, true)
+	t.Check(decodeErr.Unmapped, DeepEquals, []string{"/app/hosts/0/age", "/app/ignored", "/app/unknown", "/app/url/deeper"})
+
+	var invalid []string
+	for _, e := range decodeErr.Invalid {
+		invalid = append(invalid, e.Key)
+	}
+	t.Check(invalid, DeepEquals, []string{"/app/hosts/0/ip", "/app/hosts/x/ip", "/app/port", "/app/timeout"})
+
+	// the valid keys are decoded anyway
+	t.Check(cfg.URL, Equals, "www.google.de")
+
+	t.Check(Decode(nil, "/", cfg), NotNil)
+}
+
+func (s *FilterSuite) TestDecodeSliceIndex(t *C) {
+	var cfg decodeConfig
+	err := Decode(map[string]string{
+		"/app/hosts/9223372036854775807/ip": "192.168.0.1",
+		"/app/hosts/4000000000/ip":          "192.168.0.2",
+		"/app/hosts/2/ip":                   "192.168.0.3",
+	}, "/app", &cfg)
+
+	var decodeErr *DecodeError
+	t.Assert(errors.As(err, &decodeErr), Equals, true)
+	var invalid []string
+	for _, e := range decodeErr.Invalid {
+		invalid = append(invalid, e.Key)
+	}
+	t.Check(invalid, DeepEquals, []string{"/app/hosts/4000000000/ip", "/app/hosts/9223372036854775807/ip"})
+	// an index below the number of keys can leave a gap
+	t.Assert(cfg.Hosts, HasLen, 3)
+	t.Check(cfg.Hosts[2].IP.String(), Equals, "192.168.0.3")
+}
+
+func (s *FilterSuite) TestLoad(t *C) {
+	rw := newLayer(map[string]string{"/app/database/url": "www.google.de", "/app/database/port": "5432"})
+
+	var cfg decodeConfig
+	t.Assert(Load(rw, "/app/database", &cfg), IsNil)
+	t.Check(cfg.URL, Equals, "www.google.de")
+	t.Check(cfg.Port, Equals, uint16(5432))
+
+	rw.err = ErrUnavailable
+	t.Check(Load(rw, "/app/database", &cfg), Equals, ErrUnavailable)
+}
@@ -14,6 +14,7 @@ package env
 
 import (
 	"context"
+	"log/slog"
 	"os"
 	"strings"
 
@@ -24,11 +25,17 @@ var replacer = strings.NewReplacer("/", "_")
 var cleanReplacer = strings.NewReplacer("_", "/")
 
 // Client provides a shell for the env client
-type Client struct{}
+type Client struct {
+	logger *slog.Logger
+}
 
 // New returns a new client
-func New() (*Client, error) {
-	return &Client{}, nil
+func New(opts ...Option) (*Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	return &Client{logger: easykv.BackendLogger(options.Logger, "env")}, nil
 }
 
 // Close is only meant to fulfill the easykv.ReadWatcher interface.
@@ -38,6 +45,15 @@ func (c *Client) Close() {}
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues, ctx is only checked before the environment is read.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	allEnvVars := os.Environ()
 	envMap := make(map[string]string)
 	for _, e := range allEnvVars {
@@ -69,5 +85,16 @@ func clean(key string) string {
 
 // WatchPrefix - not implemented at the moment
 func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	c.logger.Debug("watch not supported", "prefix", prefix)
 	return 0, easykv.ErrWatchNotSupported
 }
+
+// Capabilities reports that the environment is read-only and can't be watched.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{}
+}
+
+// Ping only fails if ctx is done, the environment is always reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
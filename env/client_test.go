@@ -12,6 +12,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 
 	. "gopkg.in/check.v1"
@@ -24,6 +25,23 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New()
+		t.Assert(err, IsNil)
+		return c
+	},
+	Seed: func(t *C, rw easykv.ReadWatcher, data map[string]string) {
+		for k, v := range data {
+			os.Setenv(transform(k), v)
+		}
+	},
+	Delete: func(t *C, rw easykv.ReadWatcher, key string) {
+		os.Unsetenv(transform(key))
+	},
+	NoWatch: true,
+})
+
 func (s *FilterSuite) TestTransform(t *C) {
 	dat := transform("/foo/bar/test")
 	t.Check(dat, Equals, "FOO_BAR_TEST")
@@ -52,4 +70,14 @@ func (s *FilterSuite) TestGetValues(t *C) {
 
 	c, _ := New()
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
+}
+
+func (s *FilterSuite) TestOpen(t *C) {
+	c, err := easykv.Open("env://")
+	t.Assert(err, IsNil)
+	t.Check(c, FitsTypeOf, &Client{})
+
+	_, err = easykv.Open("env://?prefix=APP")
+	t.Check(err, ErrorMatches, "unknown env url parameters: prefix")
 }
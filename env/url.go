@@ -0,0 +1,31 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package env
+
+import (
+	"net/url"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("env", open)
+}
+
+// open creates a client from the url env://
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	if _, err := easykv.Query(u); err != nil {
+		return nil, err
+	}
+	c, err := New()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -8,10 +8,107 @@
 
 package easykv
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
 
 // ErrWatchNotSupported is returned if the backend has no watch support and the WatchPrefix method is called.
 var ErrWatchNotSupported = errors.New("this backend doesn't support watches - use polling instead")
 
 // ErrWatchCanceled is returned if the watcher is canceled.
 var ErrWatchCanceled = errors.New("watcher error: watcher canceled")
+
+// ErrWriteNotSupported is returned if the backend (or the configured source) is read-only and a Writer method is called.
+var ErrWriteNotSupported = errors.New("this backend doesn't support writes")
+
+// ErrNotSupported is returned if an optional feature is called through a wrapper like Prefixed
+// whose backend doesn't implement it.
+var ErrNotSupported = errors.New("this backend doesn't support the operation")
+
+// ErrUnknownBackend is returned by Open if no backend is registered for the url scheme.
+var ErrUnknownBackend = errors.New("unknown backend")
+
+// ErrKeyNotFound is returned if a key or prefix that has to exist is missing.
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrUnauthorized is returned if the backend rejected the credentials or denied the access.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// ErrUnavailable is returned if the backend can't be reached.
+var ErrUnavailable = errors.New("backend unavailable")
+
+// ErrTimeout is returned if a request to the backend timed out.
+var ErrTimeout = errors.New("timeout")
+
+// ErrInvalid is returned if an argument is out of range, e.g. a non-positive ttl.
+var ErrInvalid = errors.New("invalid argument")
+
+// ErrConflict is returned by a Txn if a compare failed.
+var ErrConflict = errors.New("transaction conflict")
+
+// ConflictError is the error of a Txn whose compare failed.
+// It matches ErrConflict with errors.Is.
+type ConflictError struct {
+	// Key is the key whose revision didn't match.
+	// It is empty if the backend doesn't report which compare failed.
+	Key string
+}
+
+func (e *ConflictError) Error() string {
+	if e.Key == "" {
+		return ErrConflict.Error()
+	}
+	return fmt.Sprintf("%s: key %s", ErrConflict, e.Key)
+}
+
+// Is reports whether target is ErrConflict.
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// WrapError marks err as an error of the given kind (e.g. ErrKeyNotFound).
+// The returned error matches both kind and err with errors.Is.
+// A nil err or an err that already matches kind is returned unchanged.
+func WrapError(kind, err error) error {
+	if err == nil || errors.Is(err, kind) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", kind, err)
+}
+
+// ClassifyError marks the transport errors that are common to all backends:
+// timeouts are marked as ErrTimeout, failed dials and lookups as ErrUnavailable.
+// Every other error is returned unchanged.
+func ClassifyError(err error) error {
+	if err == nil || isClassified(err) {
+		return err
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return WrapError(ErrTimeout, err)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return WrapError(ErrTimeout, err)
+	}
+
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	if errors.As(err, &opErr) || errors.As(err, &dnsErr) {
+		return WrapError(ErrUnavailable, err)
+	}
+	return err
+}
+
+func isClassified(err error) bool {
+	for _, kind := range []error{ErrKeyNotFound, ErrUnauthorized, ErrUnavailable, ErrTimeout} {
+		if errors.Is(err, kind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *FilterSuite) TestWrapError(t *C) {
+	t.Check(WrapError(ErrKeyNotFound, nil), IsNil)
+
+	native := errors.New("native error")
+	err := WrapError(ErrKeyNotFound, native)
+	t.Check(errors.Is(err, ErrKeyNotFound), Equals, true)
+	t.Check(errors.Is(err, native), Equals, true)
+	t.Check(WrapError(ErrKeyNotFound, err), Equals, err)
+}
+
+func (s *FilterSuite) TestClassifyError(t *C) {
+	t.Check(ClassifyError(nil), IsNil)
+
+	native := errors.New("native error")
+	t.Check(ClassifyError(native), Equals, native)
+
+	err := ClassifyError(context.DeadlineExceeded)
+	t.Check(errors.Is(err, ErrTimeout), Equals, true)
+	t.Check(errors.Is(err, context.DeadlineExceeded), Equals, true)
+
+	_, err = net.Dial("tcp", "127.0.0.1:1")
+	t.Assert(err, NotNil)
+	t.Check(errors.Is(ClassifyError(err), ErrUnavailable), Equals, true)
+
+	// already classified errors are kept
+	err = WrapError(ErrUnauthorized, context.DeadlineExceeded)
+	t.Check(ClassifyError(err), Equals, err)
+	t.Check(errors.Is(ClassifyError(context.Canceled), ErrTimeout), Equals, false)
+}
+
+func (s *FilterSuite) TestConflictError(t *C) {
+	var err error = &ConflictError{Key: "/app/name"}
+	t.Check(errors.Is(err, ErrConflict), Equals, true)
+	t.Check(err.Error(), Equals, "transaction conflict: key /app/name")
+	t.Check((&ConflictError{}).Error(), Equals, "transaction conflict")
+
+	var conflict *ConflictError
+	t.Assert(errors.As(fmt.Errorf("commit: %w", err), &conflict), Equals, true)
+	t.Check(conflict.Key, Equals, "/app/name")
+}
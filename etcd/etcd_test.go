@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/HeavyHorst/easykv"
+
 	. "gopkg.in/check.v1"
 )
 
@@ -50,3 +52,29 @@ func (s *FilterSuite) TestNew(t *C) {
 
 	t.Check(fmt.Sprintf("%T", c2), Equals, "*etcdv3.Client")
 }
+
+func (s *FilterSuite) TestOpen(t *C) {
+	c, err := easykv.Open("etcdv2://user:pw@127.0.0.1:2379")
+	t.Assert(err, IsNil)
+	defer c.Close()
+	t.Check(fmt.Sprintf("%T", c), Equals, "*etcdv2.Client")
+
+	c2, err := easykv.Open("etcd://127.0.0.1:2379,127.0.0.2:2379?serializable=true&request-timeout=5")
+	t.Assert(err, IsNil)
+	defer c2.Close()
+	t.Check(fmt.Sprintf("%T", c2), Equals, "*etcdv3.Client")
+
+	_, err = easykv.Open("etcd://127.0.0.1:2379?version=4")
+	t.Check(err, Equals, ErrUnknownAPILevel)
+
+	// the path is the prefix of all keys
+	c3, err := easykv.Open("etcdv3://127.0.0.1:2379/prefix?tls=true")
+	t.Assert(err, IsNil)
+	defer c3.Close()
+	t.Check(fmt.Sprintf("%T", c3), Equals, "*easykv.prefixed")
+
+	_, err = easykv.Open("etcdv3://127.0.0.1:2379?serialisable=true")
+	t.Check(err, ErrorMatches, "unknown etcdv3 url parameters: serialisable")
+	_, err = easykv.Open("etcdv3://127.0.0.1:2379?tls=1x")
+	t.Check(err, NotNil)
+}
@@ -18,9 +18,12 @@ package etcdv2
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"io/ioutil"
+	"log/slog"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -34,10 +37,16 @@ import (
 type Client struct {
 	client       client.KeysAPI
 	serializable bool
+	logger       *slog.Logger
 }
 
 // NewEtcdClient returns an *etcd.Client with a connection to named machines.
-func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool, username string, password string, serializable bool, requestTimeout time.Duration) (*Client, error) {
+func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool, username string, password string, serializable bool, requestTimeout time.Duration, opts ...Option) (*Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	logger := easykv.BackendLogger(options.Logger, "etcdv2")
 	var c client.Client
 	var kapi client.KeysAPI
 	var err error
@@ -67,7 +76,7 @@ func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool,
 	if caCert != "" {
 		certBytes, err := ioutil.ReadFile(caCert)
 		if err != nil {
-			return &Client{kapi, serializable}, err
+			return &Client{kapi, serializable, logger}, err
 		}
 
 		caCertPool := x509.NewCertPool()
@@ -81,7 +90,7 @@ func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool,
 	if cert != "" && key != "" {
 		tlsCert, err := tls.LoadX509KeyPair(cert, key)
 		if err != nil {
-			return &Client{kapi, serializable}, err
+			return &Client{kapi, serializable, logger}, err
 		}
 		tlsConfig.Certificates = []tls.Certificate{tlsCert}
 	}
@@ -91,11 +100,12 @@ func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool,
 
 	c, err = client.New(cfg)
 	if err != nil {
-		return &Client{kapi, serializable}, err
+		return &Client{kapi, serializable, logger}, err
 	}
 
 	kapi = client.NewKeysAPI(c)
-	return &Client{kapi, serializable}, nil
+	logger.Debug("client created", "endpoints", machines)
+	return &Client{kapi, serializable, logger}, nil
 }
 
 // Close is only meant to fulfill the easykv.ReadWatcher interface.
@@ -105,15 +115,20 @@ func (c *Client) Close() {}
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests are bound to ctx.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	vars := make(map[string]string)
 	for _, key := range keys {
-		resp, err := c.client.Get(context.Background(), key, &client.GetOptions{
+		resp, err := c.client.Get(ctx, key, &client.GetOptions{
 			Recursive: true,
 			Sort:      true,
 			Quorum:    !c.serializable,
 		})
 		if err != nil {
-			return vars, err
+			return vars, wrapError(err)
 		}
 		err = nodeWalk(resp.Node, vars)
 		if err != nil {
@@ -138,17 +153,121 @@ func nodeWalk(node *client.Node, vars map[string]string) error {
 	return nil
 }
 
-// WatchPrefix watches a specific prefix for changes.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	entries := make(map[string]easykv.Entry)
+	for _, key := range keys {
+		resp, err := c.client.Get(ctx, key, &client.GetOptions{
+			Recursive: true,
+			Sort:      true,
+			Quorum:    !c.serializable,
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		entryWalk(resp.Node, entries)
+	}
+
+	list := make([]easykv.Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// entryWalk recursively descends nodes, updating entries.
+func entryWalk(node *client.Node, entries map[string]easykv.Entry) {
+	if node == nil {
+		return
+	}
+	if node.Dir {
+		for _, node := range node.Nodes {
+			entryWalk(node, entries)
+		}
+		return
+	}
+	e := easykv.Entry{
+		Key:            node.Key,
+		Value:          []byte(node.Value),
+		Revision:       node.ModifiedIndex,
+		CreateRevision: node.CreatedIndex,
+		TTL:            node.TTLDuration(),
+	}
+	entries[e.Key] = e
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	_, err := c.client.Set(ctx, key, value, nil)
+	return wrapError(err)
+}
+
+// SetWithTTL sets the value of key with ttl and refreshes the ttl until the lease is closed.
+// Closing the lease removes the key, unless it was changed in the meantime.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Set(ctx, key, value, &client.SetOptions{TTL: ttl})
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	// a refresh doesn't change the index, so it identifies our value
+	index := resp.Node.ModifiedIndex
+
+	refresh := func(ctx context.Context) error {
+		_, err := c.client.Set(ctx, key, "", &client.SetOptions{TTL: ttl, Refresh: true, PrevIndex: index})
+		if isTestFailed(err) {
+			return easykv.ErrKeyNotFound
+		}
+		return wrapError(err)
+	}
+	release := func(ctx context.Context) error {
+		_, err := c.client.Delete(ctx, key, &client.DeleteOptions{PrevIndex: index})
+		if isTestFailed(err) || errors.Is(wrapError(err), easykv.ErrKeyNotFound) {
+			return nil
+		}
+		return wrapError(err)
+	}
+	return easykv.NewLease(ttl, refresh, release), nil
+}
+
+// isTestFailed reports whether err is the error of a failed compare.
+func isTestFailed(err error) bool {
+	var etcdErr client.Error
+	return errors.As(err, &etcdErr) && etcdErr.Code == client.ErrorCodeTestFailed
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.Delete(ctx, key, nil)
+	return wrapError(err)
+}
+
+// DeletePrefix removes the directory prefix and all keys below it.
+// Unlike etcdv3 the prefix has to be a full path segment, as etcdv2 stores keys in a directory tree.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	_, err := c.client.Delete(ctx, prefix, &client.DeleteOptions{Recursive: true})
+	return wrapError(err)
+}
+
+// WatchPrefix watches a specific prefix for changes and returns the index of the change.
+// WithWaitIndex resumes the watch after the given index, an index that was cleared returns 0.
+// If no keys are given, every change below prefix is reported.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	var options easykv.WatchOptions
 	for _, o := range opts {
 		o(&options)
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	// Setting AfterIndex to 0 (default) means that the Watcher
 	// should start watching for events starting at the current
 	// index, whatever that may be.
-	watcher := c.client.Watcher(prefix, &client.WatcherOptions{AfterIndex: uint64(0), Recursive: true})
+	watcher := c.client.Watcher(prefix, &client.WatcherOptions{AfterIndex: options.WaitIndex, Recursive: true})
 	etcdctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -158,23 +277,36 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 			if err == context.Canceled {
 				return options.WaitIndex, easykv.ErrWatchCanceled
 			}
-			switch e := err.(type) {
-			case *client.Error:
-				if e.Code == 401 {
-					return 0, nil
-				}
+			var etcdErr client.Error
+			if errors.As(err, &etcdErr) && etcdErr.Code == client.ErrorCodeEventIndexCleared {
+				c.logger.Warn("watch index cleared", "prefix", prefix, "index", options.WaitIndex, "error", err)
+				return 0, nil
 			}
-			return options.WaitIndex, err
+			return options.WaitIndex, wrapError(err)
 		}
 
 		// Only return if we have a key prefix we care about.
 		// This is not an exact match on the key so there is a chance
 		// we will still pickup on false positives. The net win here
 		// is reducing the scope of keys that can trigger updates.
+		if len(options.Keys) == 0 {
+			return resp.Node.ModifiedIndex, nil
+		}
 		for _, k := range options.Keys {
 			if strings.HasPrefix(resp.Node.Key, k) {
-				return resp.Node.ModifiedIndex, err
+				return resp.Node.ModifiedIndex, nil
 			}
 		}
 	}
 }
+
+// Capabilities reports the features of etcdv2, its values are json strings and can't hold binary data.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Revisions: true}
+}
+
+// Ping reads the root directory without its children.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.client.Get(ctx, "/", &client.GetOptions{Quorum: !c.serializable})
+	return wrapError(err)
+}
@@ -9,12 +9,17 @@
 package etcdv2
 
 import (
+	"bytes"
 	"context"
+	"log/slog"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
+	"go.etcd.io/etcd/client/v2"
 
 	. "gopkg.in/check.v1"
 )
@@ -26,6 +31,14 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+		t.Assert(err, IsNil)
+		return c
+	},
+})
+
 func (s *FilterSuite) TestGetValues(t *C) {
 	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
 	if err != nil {
@@ -43,6 +56,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	c.client.Set(context.Background(), "/remtest/database/hosts/1/size", "80", nil)
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchPrefix(t *C) {
@@ -83,3 +97,43 @@ func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+// clearedKeysAPI returns watchers that fail like etcd if the watched index was compacted.
+type clearedKeysAPI struct {
+	client.KeysAPI
+	afterIndex uint64
+}
+
+func (a *clearedKeysAPI) Watcher(key string, opts *client.WatcherOptions) client.Watcher {
+	a.afterIndex = opts.AfterIndex
+	return clearedWatcher{}
+}
+
+type clearedWatcher struct{}
+
+func (clearedWatcher) Next(ctx context.Context) (*client.Response, error) {
+	return nil, client.Error{Code: client.ErrorCodeEventIndexCleared, Message: "The event in requested index is outdated and cleared"}
+}
+
+func (s *FilterSuite) TestWatchPrefixIndexCleared(t *C) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	api := &clearedKeysAPI{}
+	c := &Client{client: api, logger: logger}
+
+	index, err := c.WatchPrefix(context.Background(), "/app", easykv.WithWaitIndex(42))
+	t.Check(api.afterIndex, Equals, uint64(42))
+	t.Check(err, IsNil)
+	t.Check(index, Equals, uint64(0))
+	t.Check(strings.Contains(buf.String(), "watch index cleared"), Equals, true)
+}
@@ -0,0 +1,41 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package etcdv2
+
+import (
+	"errors"
+
+	"github.com/HeavyHorst/easykv"
+	"go.etcd.io/etcd/client/v2"
+)
+
+// wrapError marks the errors of the etcd client with the easykv error kinds.
+func wrapError(err error) error {
+	var etcdErr client.Error
+	if errors.As(err, &etcdErr) {
+		switch etcdErr.Code {
+		case client.ErrorCodeKeyNotFound:
+			return easykv.WrapError(easykv.ErrKeyNotFound, err)
+		case client.ErrorCodeUnauthorized:
+			return easykv.WrapError(easykv.ErrUnauthorized, err)
+		}
+		return err
+	}
+
+	var clusterErr *client.ClusterError
+	if errors.As(err, &clusterErr) {
+		for _, e := range clusterErr.Errors {
+			if errors.Is(easykv.ClassifyError(e), easykv.ErrTimeout) {
+				return easykv.WrapError(easykv.ErrTimeout, err)
+			}
+		}
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	}
+	return easykv.ClassifyError(err)
+}
@@ -0,0 +1,26 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package etcdv2
+
+import "log/slog"
+
+// Options contains the optional values of the etcdv2 client.
+type Options struct {
+	Logger *slog.Logger
+}
+
+// Option configures the etcdv2 client.
+type Option func(*Options)
+
+// WithLogger sets the logger for watches, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -9,7 +9,12 @@
 package etcdv3
 
 import (
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"context"
@@ -24,10 +29,16 @@ type Client struct {
 	client         *clientv3.Client
 	serializable   bool
 	requestTimeout time.Duration
+	logger         *slog.Logger
 }
 
 // NewEtcdClient returns an *etcdv3.Client with a connection to named machines.
-func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool, username string, password string, serializable bool, requestTimeout time.Duration) (*Client, error) {
+func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool, username string, password string, serializable bool, requestTimeout time.Duration, opts ...Option) (*Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	logger := easykv.BackendLogger(options.Logger, "etcdv3")
 	var cli *clientv3.Client
 	cfg := clientv3.Config{
 		Endpoints:   machines,
@@ -54,16 +65,22 @@ func NewEtcdClient(machines []string, cert, key, caCert string, basicAuth bool,
 	if tls {
 		clientConf, err := tlsInfo.ClientConfig()
 		if err != nil {
-			return &Client{cli, serializable, requestTimeout}, err
+			return &Client{cli, serializable, requestTimeout, logger}, err
 		}
 		cfg.TLS = clientConf
 	}
 
 	cli, err := clientv3.New(cfg)
 	if err != nil {
-		return &Client{cli, serializable, requestTimeout}, err
+		// the dial timeout expired without reaching any endpoint
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = easykv.WrapError(easykv.ErrUnavailable, err)
+		}
+		logger.Error("connect failed", "endpoints", machines, "error", err)
+		return &Client{cli, serializable, requestTimeout, logger}, wrapError(err)
 	}
-	return &Client{cli, serializable, requestTimeout}, nil
+	logger.Debug("connected", "endpoints", machines)
+	return &Client{cli, serializable, requestTimeout, logger}, nil
 }
 
 // Close closes the etcdv3 client connection.
@@ -76,9 +93,15 @@ func (c *Client) Close() {
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests are bound to ctx.
+// The request timeout still applies to every single request.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	vars := make(map[string]string)
 	for _, key := range keys {
-		ctx, cancel := context.WithTimeout(context.Background(), c.requestTimeout)
+		ctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
 		opts := []clientv3.OpOption{clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend)}
 		if c.serializable {
 			opts = append(opts, clientv3.WithSerializable())
@@ -86,7 +109,7 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 		resp, err := c.client.Get(ctx, key, opts...)
 		cancel()
 		if err != nil {
-			return vars, err
+			return vars, wrapError(err)
 		}
 		for _, ev := range resp.Kvs {
 			vars[string(ev.Key)] = string(ev.Value)
@@ -95,31 +118,262 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 	return vars, nil
 }
 
-// WatchPrefix watches a specific prefix for changes.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+// The TTL is looked up for every lease that a key is bound to.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	entries := make(map[string]easykv.Entry)
+	ttls := make(map[clientv3.LeaseID]time.Duration)
+	for _, key := range keys {
+		rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if c.serializable {
+			opts = append(opts, clientv3.WithSerializable())
+		}
+		resp, err := c.client.Get(rctx, key, opts...)
+		cancel()
+		if err != nil {
+			return nil, wrapError(err)
+		}
+
+		for _, kv := range resp.Kvs {
+			e := easykv.Entry{
+				Key:            string(kv.Key),
+				Value:          kv.Value,
+				Revision:       uint64(kv.ModRevision),
+				CreateRevision: uint64(kv.CreateRevision),
+				Version:        uint64(kv.Version),
+			}
+			if kv.Lease != 0 {
+				lease := clientv3.LeaseID(kv.Lease)
+				ttl, ok := ttls[lease]
+				if !ok {
+					rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+					ttlResp, err := c.client.TimeToLive(rctx, lease)
+					cancel()
+					if err != nil {
+						return nil, wrapError(err)
+					}
+					ttl = time.Duration(ttlResp.TTL) * time.Second
+					ttls[lease] = ttl
+				}
+				e.Lease = strconv.FormatInt(kv.Lease, 16)
+				e.TTL = ttl
+			}
+			entries[e.Key] = e
+		}
+	}
+
+	list := make([]easykv.Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// GetSnapshot returns the values of all prefixes in keys at a single revision.
+// The prefixes after the first one are read at the revision of the first response.
+func (c *Client) GetSnapshot(ctx context.Context, keys []string) (easykv.Snapshot, error) {
+	snap := easykv.Snapshot{Values: make(map[string]string)}
+	var rev int64
+	for _, key := range keys {
+		rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		opts := []clientv3.OpOption{clientv3.WithPrefix()}
+		if c.serializable {
+			opts = append(opts, clientv3.WithSerializable())
+		}
+		if rev > 0 {
+			opts = append(opts, clientv3.WithRev(rev))
+		}
+		resp, err := c.client.Get(rctx, key, opts...)
+		cancel()
+		if err != nil {
+			return easykv.Snapshot{}, wrapError(err)
+		}
+		if rev == 0 {
+			rev = resp.Header.Revision
+		}
+		for _, kv := range resp.Kvs {
+			snap.Values[string(kv.Key)] = string(kv.Value)
+		}
+	}
+
+	if rev == 0 {
+		// no prefixes, report the current revision
+		rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		resp, err := c.client.Get(rctx, "\x00", clientv3.WithCountOnly())
+		cancel()
+		if err != nil {
+			return easykv.Snapshot{}, wrapError(err)
+		}
+		rev = resp.Header.Revision
+	}
+	snap.Revision = uint64(rev)
+	return snap, nil
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	_, err := c.client.Put(ctx, key, value)
+	return wrapError(err)
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.client.Delete(ctx, key)
+	return wrapError(err)
+}
+
+// DeletePrefix removes all keys with the given prefix.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	_, err := c.client.Delete(ctx, prefix, clientv3.WithPrefix())
+	return wrapError(err)
+}
+
+// SetWithTTL sets the value of key bound to a new lease with ttl, rounded up to whole seconds.
+// The lease is kept alive until it is closed, closing it revokes the lease and removes the key.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	grant, err := c.client.Grant(ctx, seconds)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	if _, err := c.client.Put(ctx, key, value, clientv3.WithLease(grant.ID)); err != nil {
+		c.client.Revoke(context.Background(), grant.ID)
+		return nil, wrapError(err)
+	}
+
+	kactx, cancel := context.WithCancel(context.Background())
+	ch, err := c.client.KeepAlive(kactx, grant.ID)
+	if err != nil {
+		cancel()
+		c.client.Revoke(context.Background(), grant.ID)
+		return nil, wrapError(err)
+	}
+
+	l := &lease{c: c, id: grant.ID, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(l.done)
+		// the channel is closed if the lease expired or the keep alive was canceled
+		for range ch {
+		}
+	}()
+	return l, nil
+}
+
+// lease is an etcd lease that is kept alive by the client.
+type lease struct {
+	c      *Client
+	id     clientv3.LeaseID
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+func (l *lease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *lease) Close() error {
+	l.once.Do(func() {
+		l.cancel()
+		<-l.done
+		ctx, cancel := context.WithTimeout(context.Background(), l.c.requestTimeout)
+		defer cancel()
+		_, err := l.c.client.Revoke(ctx, l.id)
+		// an expired lease has already removed its keys
+		if err = wrapError(err); !errors.Is(err, easykv.ErrKeyNotFound) {
+			l.err = err
+		}
+	})
+	return l.err
+}
+
+// CompareAndSwap sets the value of key if its ModRevision is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return c.Commit(ctx, []easykv.Compare{{Key: key, Revision: revision}}, []easykv.TxnOp{easykv.PutOp(key, value)})
+}
+
+// Commit applies all ops in one etcd transaction if the ModRevisions of all cmps match.
+// If a compare fails, the keys of cmps are read in the same transaction to report the conflicting key.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	conds := make([]clientv3.Cmp, 0, len(cmps))
+	gets := make([]clientv3.Op, 0, len(cmps))
+	for _, cmp := range cmps {
+		conds = append(conds, clientv3.Compare(clientv3.ModRevision(cmp.Key), "=", int64(cmp.Revision)))
+		gets = append(gets, clientv3.OpGet(cmp.Key))
+	}
+
+	writes := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		if op.Delete {
+			writes = append(writes, clientv3.OpDelete(op.Key))
+		} else {
+			writes = append(writes, clientv3.OpPut(op.Key, op.Value))
+		}
+	}
+
+	resp, err := c.client.Txn(ctx).If(conds...).Then(writes...).Else(gets...).Commit()
+	if err != nil {
+		return wrapError(err)
+	}
+	if resp.Succeeded {
+		return nil
+	}
+
+	for i, r := range resp.Responses {
+		var revision int64
+		if kvs := r.GetResponseRange().GetKvs(); len(kvs) > 0 {
+			revision = kvs[0].ModRevision
+		}
+		if uint64(revision) != cmps[i].Revision {
+			return &easykv.ConflictError{Key: cmps[i].Key}
+		}
+	}
+	return &easykv.ConflictError{}
+}
+
+// WatchPrefix watches a specific prefix for changes and returns the revision of the change.
+// WithWaitIndex resumes the watch after the given revision, a revision that was compacted returns 0.
+// If no keys are given, every change below prefix is reported.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	var options easykv.WatchOptions
 	for _, o := range opts {
 		o(&options)
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	etcdctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	var err error
 
-	rch := c.client.Watch(etcdctx, prefix, clientv3.WithPrefix())
+	wopts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if options.WaitIndex > 0 {
+		wopts = append(wopts, clientv3.WithRev(int64(options.WaitIndex)+1))
+	}
+
+	rch := c.client.Watch(etcdctx, prefix, wopts...)
 	for wresp := range rch {
+		if wresp.CompactRevision > 0 {
+			c.logger.Warn("watch revision compacted", "prefix", prefix, "index", options.WaitIndex, "compacted", wresp.CompactRevision)
+			return 0, nil
+		}
 		if wresp.Err() != nil {
-			return options.WaitIndex, wresp.Err()
+			return options.WaitIndex, wrapError(wresp.Err())
 		}
 		for _, ev := range wresp.Events {
 			// Only return if we have a key prefix we care about.
 			// This is not an exact match on the key so there is a chance
 			// we will still pickup on false positives. The net win here
 			// is reducing the scope of keys that can trigger updates.
-			for _, k := range options.Keys {
-				if strings.HasPrefix(string(ev.Kv.Key), k) {
-					return uint64(ev.Kv.Version), err
-				}
+			if matchKeys(string(ev.Kv.Key), options.Keys) {
+				return uint64(ev.Kv.ModRevision), nil
 			}
 		}
 	}
@@ -128,3 +382,85 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 	}
 	return 0, err
 }
+
+// Watch streams all changes below prefix.
+// WithWaitIndex starts the watch after the given revision.
+func (c *Client) Watch(ctx context.Context, prefix string, opts ...easykv.WatchOption) (<-chan easykv.Event, error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	wopts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if options.WaitIndex > 0 {
+		wopts = append(wopts, clientv3.WithRev(int64(options.WaitIndex)+1))
+	}
+
+	events := make(chan easykv.Event)
+	rch := c.client.Watch(ctx, prefix, wopts...)
+	go func() {
+		defer close(events)
+		for wresp := range rch {
+			if wresp.Err() != nil {
+				select {
+				case events <- easykv.Event{Err: wrapError(wresp.Err())}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			for _, ev := range wresp.Events {
+				e := easykv.Event{
+					Key:      string(ev.Kv.Key),
+					Value:    string(ev.Kv.Value),
+					Type:     easykv.EventPut,
+					Revision: uint64(ev.Kv.ModRevision),
+				}
+				if ev.Type == clientv3.EventTypeDelete {
+					e.Type = easykv.EventDelete
+				}
+				if !matchKeys(e.Key, options.Keys) {
+					continue
+				}
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// matchKeys reports whether key starts with one of keys.
+// An empty keys slice matches every key.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports the features of etcdv3.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Transactions: true, Revisions: true, BinaryValues: true}
+}
+
+// Ping asks the endpoints for their status, it succeeds if one of them answers.
+func (c *Client) Ping(ctx context.Context) error {
+	var err error
+	for _, endpoint := range c.client.Endpoints() {
+		rctx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+		_, err = c.client.Status(rctx, endpoint)
+		cancel()
+		if err == nil {
+			return nil
+		}
+	}
+	return wrapError(err)
+}
@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 
 	. "gopkg.in/check.v1"
@@ -26,6 +27,14 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+		t.Assert(err, IsNil)
+		return c
+	},
+})
+
 func (s *FilterSuite) TestGetValues(t *C) {
 	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
 	if err != nil {
@@ -43,6 +52,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	c.client.Put(context.Background(), "/remtest/database/hosts/1/size", "80")
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchPrefix(t *C) {
@@ -83,3 +93,43 @@ func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestWatch(t *C) {
+	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Watch(t, c)
+}
+
+func (s *FilterSuite) TestLock(t *C) {
+	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Locker(t, c)
+}
+
+func (s *FilterSuite) TestElection(t *C) {
+	c, err := NewEtcdClient([]string{"http://localhost:2379"}, "", "", "", false, "", "", false, time.Duration(3)*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Elector(t, c)
+}
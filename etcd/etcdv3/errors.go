@@ -0,0 +1,45 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package etcdv3
+
+import (
+	"errors"
+
+	"github.com/HeavyHorst/easykv"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// wrapError marks the errors of the etcd client with the easykv error kinds.
+// The client returns either etcd errors or plain grpc status errors, both carry a grpc code.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	code := codes.Unknown
+	var etcdErr interface{ Code() codes.Code }
+	if errors.As(err, &etcdErr) {
+		code = etcdErr.Code()
+	} else if s, ok := status.FromError(err); ok {
+		code = s.Code()
+	}
+
+	switch code {
+	case codes.NotFound:
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	case codes.Unavailable:
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	case codes.DeadlineExceeded:
+		return easykv.WrapError(easykv.ErrTimeout, err)
+	}
+	return easykv.ClassifyError(err)
+}
@@ -0,0 +1,140 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package etcdv3
+
+import (
+	"context"
+	"sync"
+
+	"github.com/HeavyHorst/easykv/lock"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// closed is returned by Done if there is nothing to wait for.
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Lock acquires the lock key with a concurrency.Mutex.
+// Every lock has its own session, the lock is lost if the session can't be kept alive.
+func (c *Client) Lock(ctx context.Context, key string) (lock.Lock, error) {
+	session, err := concurrency.NewSession(c.client, concurrency.WithContext(context.Background()))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	m := concurrency.NewMutex(session, key)
+	if err := m.Lock(ctx); err != nil {
+		session.Close()
+		return nil, wrapError(err)
+	}
+	return &mutex{session: session, mutex: m}, nil
+}
+
+type mutex struct {
+	session *concurrency.Session
+	mutex   *concurrency.Mutex
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	err := m.mutex.Unlock(ctx)
+	// closing the session revokes its lease, which releases the lock anyway
+	if cerr := m.session.Close(); err == nil {
+		err = cerr
+	}
+	return wrapError(err)
+}
+
+func (m *mutex) Done() <-chan struct{} {
+	return m.session.Done()
+}
+
+// Election returns a candidate for the election key, based on concurrency.Election.
+func (c *Client) Election(key string) lock.Election {
+	return &election{c: c, key: key}
+}
+
+type election struct {
+	c   *Client
+	key string
+
+	mu       sync.Mutex
+	session  *concurrency.Session // of the won campaign
+	election *concurrency.Election
+}
+
+func (e *election) Campaign(ctx context.Context, value string) error {
+	session, err := concurrency.NewSession(e.c.client, concurrency.WithContext(context.Background()))
+	if err != nil {
+		return wrapError(err)
+	}
+	el := concurrency.NewElection(session, e.key)
+	if err := el.Campaign(ctx, value); err != nil {
+		session.Close()
+		return wrapError(err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session != nil {
+		e.session.Close()
+	}
+	e.session, e.election = session, el
+	return nil
+}
+
+func (e *election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return nil
+	}
+	err := e.election.Resign(ctx)
+	if cerr := e.session.Close(); err == nil {
+		err = cerr
+	}
+	e.session, e.election = nil, nil
+	return wrapError(err)
+}
+
+func (e *election) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.session == nil {
+		return closed
+	}
+	return e.session.Done()
+}
+
+// Observe watches the candidate with the lowest create revision below the election key.
+func (e *election) Observe(ctx context.Context) <-chan string {
+	leaders := make(chan string)
+	go func() {
+		defer close(leaders)
+		// concurrency.Election needs a session, its lease isn't used for observing
+		session, err := concurrency.NewSession(e.c.client, concurrency.WithContext(ctx))
+		if err != nil {
+			return
+		}
+		defer session.Close()
+
+		for resp := range concurrency.NewElection(session, e.key).Observe(ctx) {
+			if len(resp.Kvs) == 0 {
+				continue
+			}
+			select {
+			case leaders <- string(resp.Kvs[0].Value):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return leaders
+}
@@ -8,6 +8,8 @@
 
 package etcd
 
+import "log/slog"
+
 // Options contains all values that are needed to connect to etcd.
 type Options struct {
 	Nodes          []string
@@ -16,6 +18,7 @@ type Options struct {
 	RequestTimeout int
 	TLS            TLSOptions
 	Auth           BasicAuthOptions
+	Logger         *slog.Logger
 }
 
 // TLSOptions contains all certificates and keys.
@@ -66,3 +69,10 @@ func WithRequestTimeout(t int) Option {
 		o.RequestTimeout = t
 	}
 }
+
+// WithLogger sets the logger for connects and watches, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
@@ -10,11 +10,15 @@ package file
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
-
+	"sync"
 	"time"
 
 	"github.com/HeavyHorst/easykv"
@@ -27,6 +31,10 @@ type Client struct {
 	filepath   string
 	isURL      bool
 	httpClient http.Client
+	logger     *slog.Logger
+
+	// mu serializes writes to the local file
+	mu sync.Mutex
 }
 
 // transport is a wrapper around any provided underlying transport that will
@@ -56,7 +64,7 @@ func New(filepath string, opts ...Option) (*Client, error) {
 		o(&options)
 	}
 
-	c := &Client{filepath: filepath}
+	c := &Client{filepath: filepath, logger: easykv.BackendLogger(options.Logger, "file")}
 	if strings.HasPrefix(filepath, "http://") || strings.HasPrefix(filepath, "https://") {
 		c.isURL = true
 		c.httpClient = http.Client{
@@ -72,27 +80,18 @@ func New(filepath string, opts ...Option) (*Client, error) {
 // GetValues returns all key-value pairs from the yaml or json file where the
 // keys begins with one of the prefixes specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the http request for remote files is bound to ctx.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	yamlMap := make(map[interface{}]interface{})
 	vars := make(map[string]string)
 	kvs := make(map[string]string)
 
-	var data []byte
-	var err error
-	if c.isURL {
-		resp, err := c.httpClient.Get(c.filepath)
-		if err != nil {
-			return vars, err
-		}
-		defer resp.Body.Close()
-		data, err = ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return vars, err
-		}
-	} else {
-		data, err = ioutil.ReadFile(c.filepath)
-		if err != nil {
-			return vars, err
-		}
+	data, err := c.read(ctx)
+	if err != nil {
+		return vars, wrapError(err)
 	}
 
 	err = yaml.Unmarshal(data, &yamlMap)
@@ -113,6 +112,100 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 	return kvs, nil
 }
 
+// read returns the raw content of the local or remote file.
+func (c *Client) read(ctx context.Context) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !c.isURL {
+		return ioutil.ReadFile(c.filepath)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.filepath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, statusError(resp)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Set sets the value of key in the yaml or json file.
+// Missing parent nodes are created as maps, numeric path segments index into existing lists.
+// Writes are only supported for local files.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	return c.update(func(root interface{}) (interface{}, error) {
+		return setNode(root, strings.Split(strings.Trim(key, "/"), "/"), value)
+	})
+}
+
+// Delete removes key from the yaml or json file.
+// Only the last elements of a list can be removed, as removing any other element would renumber the ones after it;
+// such deletes fail with an error marked as easykv.ErrInvalid.
+// Writes are only supported for local files.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.update(func(root interface{}) (interface{}, error) {
+		root, _, err := pruneNode(root, "", key, true)
+		return root, err
+	})
+}
+
+// DeletePrefix removes all keys with the given prefix from the yaml or json file.
+// Like Delete, it fails with an error marked as easykv.ErrInvalid if a list element other than the last ones would be removed.
+// Writes are only supported for local files.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	return c.update(func(root interface{}) (interface{}, error) {
+		root, _, err := pruneNode(root, "", prefix, false)
+		return root, err
+	})
+}
+
+// update reads the local file, applies fn to the decoded document and writes the result back.
+// Files ending in .json are written as json, everything else as yaml.
+func (c *Client) update(fn func(root interface{}) (interface{}, error)) error {
+	if c.isURL {
+		return easykv.ErrWriteNotSupported
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mode := os.FileMode(0666)
+	if fi, err := os.Stat(c.filepath); err == nil {
+		mode = fi.Mode()
+	}
+
+	data, err := ioutil.ReadFile(c.filepath)
+	if err != nil && !os.IsNotExist(err) {
+		return wrapError(err)
+	}
+
+	var root interface{}
+	if err = yaml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+
+	if root, err = fn(root); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(c.filepath, ".json") {
+		data, err = json.MarshalIndent(jsonNode(root), "", "\t")
+	} else {
+		data, err = yaml.Marshal(root)
+	}
+	if err != nil {
+		return err
+	}
+	return wrapError(ioutil.WriteFile(c.filepath, data, mode))
+}
+
 // Close is only meant to fulfill the easykv.ReadWatcher interface.
 // Does nothing.
 func (c *Client) Close() {}
@@ -136,16 +229,144 @@ func nodeWalk(node interface{}, key string, vars map[string]string) error {
 	return nil
 }
 
+// setNode sets the value at path below node and returns the updated node.
+func setNode(node interface{}, path []string, value string) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	switch n := node.(type) {
+	case nil:
+		m := make(map[interface{}]interface{})
+		v, err := setNode(nil, path[1:], value)
+		m[path[0]] = v
+		return m, err
+	case map[interface{}]interface{}:
+		k := mapKey(n, path[0])
+		v, err := setNode(n[k], path[1:], value)
+		n[k] = v
+		return n, err
+	case []interface{}:
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > len(n) {
+			return n, fmt.Errorf("invalid list index %q", path[0])
+		}
+		if i == len(n) {
+			n = append(n, nil)
+		}
+		n[i], err = setNode(n[i], path[1:], value)
+		return n, err
+	default:
+		return n, fmt.Errorf("can't set %q below the scalar value %v", strings.Join(path, "/"), n)
+	}
+}
+
+// mapKey returns the key of m that nodeWalk would format as k.
+// Keys which don't exist yet are added as strings.
+func mapKey(m map[interface{}]interface{}, k string) interface{} {
+	for key := range m {
+		if fmt.Sprintf("%v", key) == k {
+			return key
+		}
+	}
+	return k
+}
+
+// pruneNode removes all values below node whose key (as produced by nodeWalk) begins with prefix,
+// or matches prefix exactly if exact is true. It returns the pruned node and whether the node itself should be removed.
+func pruneNode(node interface{}, key, prefix string, exact bool) (interface{}, bool, error) {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		if len(n) == 0 {
+			return n, false, nil
+		}
+		for k, v := range n {
+			child, remove, err := pruneChild(v, fmt.Sprintf("%s/%v", key, k), prefix, exact)
+			if err != nil {
+				return n, false, err
+			}
+			if remove {
+				delete(n, k)
+			} else {
+				n[k] = child
+			}
+		}
+		return n, len(n) == 0, nil
+	case []interface{}:
+		if len(n) == 0 {
+			return n, false, nil
+		}
+		// only the tail of a list can be removed without renumbering the elements after it
+		tail := true
+		for i := len(n) - 1; i >= 0; i-- {
+			elem := fmt.Sprintf("%s/%d", key, i)
+			child, remove, err := pruneChild(n[i], elem, prefix, exact)
+			if err != nil {
+				return n, false, err
+			}
+			switch {
+			case remove && !tail:
+				return n, false, fmt.Errorf("%w: can't remove %s, it isn't the last element of the list", easykv.ErrInvalid, elem)
+			case remove:
+				n = n[:i]
+			default:
+				tail = false
+				n[i] = child
+			}
+		}
+		return n, len(n) == 0, nil
+	case nil:
+		return n, false, nil
+	default:
+		if exact {
+			return n, key == prefix, nil
+		}
+		return n, strings.HasPrefix(key, prefix), nil
+	}
+}
+
+func pruneChild(node interface{}, key, prefix string, exact bool) (interface{}, bool, error) {
+	if !exact && strings.HasPrefix(key, prefix) {
+		return node, true, nil
+	}
+	if strings.HasPrefix(prefix, key) {
+		return pruneNode(node, key, prefix, exact)
+	}
+	return node, false, nil
+}
+
+// jsonNode converts the yaml map types to types encoding/json can marshal.
+func jsonNode(node interface{}) interface{} {
+	switch n := node.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(n))
+		for k, v := range n {
+			m[fmt.Sprintf("%v", k)] = jsonNode(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range n {
+			n[i] = jsonNode(v)
+		}
+		return n
+	default:
+		return n
+	}
+}
+
 // WatchPrefix watches the file for changes with fsnotify.
 // Prefix, keys and waitIndex are only here to implement the StoreClient interface.
 // WatchPrefix is only supported for local files. Remote files over http/https arent supported.
 // Remote filesystems like nfs are also not supported.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	if c.isURL {
 		// watch is not supported for urls
 		return 0, easykv.ErrWatchNotSupported
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "file", c.filepath)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return 0, err
@@ -154,7 +375,7 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 
 	err = watcher.Add(c.filepath)
 	if err != nil {
-		return 0, err
+		return 0, wrapError(err)
 	}
 
 	for {
@@ -170,3 +391,34 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 		}
 	}
 }
+
+// Capabilities reports the features of the file backend.
+// Files that are read from an url can't be watched or written.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: !c.isURL, Write: !c.isURL}
+}
+
+// Ping stats the local file or sends a HEAD request to the url.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !c.isURL {
+		_, err := os.Stat(c.filepath)
+		return wrapError(err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.filepath, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return wrapError(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return statusError(resp)
+	}
+	return nil
+}
@@ -10,15 +10,19 @@ package file
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 
 	. "gopkg.in/check.v1"
@@ -31,6 +35,17 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+// the file is rewritten on every change, so every watch fires
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New(t.MkDir() + "/conformance.yml")
+		t.Assert(err, IsNil)
+		return c
+	},
+	LooseKeys:   true,
+	NoWaitIndex: true,
+})
+
 const filepathYML string = "/tmp/easyKV_filetest.yml"
 const testfileYML string = `
 remtest:
@@ -134,6 +149,57 @@ func (s *FilterSuite) TestGetValuesJSON2(t *C) {
 	}, t)
 }
 
+func (s *FilterSuite) TestGetValuesContext(t *C) {
+	err := ioutil.WriteFile(filepathYML, []byte(testfileYML), 0666)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filepathYML)
+
+	c, _ := New(filepathYML)
+	testutils.GetValuesContext(t, c)
+}
+
+func (s *FilterSuite) TestGetValuesContextHTTP(t *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+		fmt.Fprint(w, testfileYML)
+	}))
+	defer ts.Close()
+
+	c, _ := New(ts.URL)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := c.GetValuesContext(ctx, []string{"/"})
+	t.Check(errors.Is(err, context.DeadlineExceeded), Equals, true)
+	t.Check(errors.Is(err, easykv.ErrTimeout), Equals, true)
+}
+
+func (s *FilterSuite) TestErrors(t *C) {
+	c, _ := New("/tmp/easykv-does-not-exist.yml")
+	_, err := c.GetValues([]string{"/"})
+	t.Check(errors.Is(err, easykv.ErrKeyNotFound), Equals, true)
+	t.Check(errors.Is(err, os.ErrNotExist), Equals, true)
+
+	for code, kind := range map[int]error{
+		http.StatusNotFound:           easykv.ErrKeyNotFound,
+		http.StatusUnauthorized:       easykv.ErrUnauthorized,
+		http.StatusForbidden:          easykv.ErrUnauthorized,
+		http.StatusServiceUnavailable: easykv.ErrUnavailable,
+	} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}))
+		c, _ := New(ts.URL)
+		_, err := c.GetValues([]string{"/"})
+		ts.Close()
+		t.Check(errors.Is(err, kind), Equals, true, Commentf("status %d: %v", code, err))
+	}
+}
+
 func (s *FilterSuite) TestWatchPrefix(t *C) {
 	err := ioutil.WriteFile(filepathYML, []byte(testfileYML), 0666)
 	if err != nil {
@@ -204,3 +270,124 @@ func (s *FilterSuite) TestHTTPWithHeaders(t *C) {
 	testHeader("/Content-Type", "application/json")
 	testHeader("/X-Nonexistent", "")
 }
+
+func (s *FilterSuite) TestWriterYML(t *C) {
+	err := ioutil.WriteFile(filepathYML, []byte(testfileYML), 0666)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filepathYML)
+
+	c, _ := New(filepathYML)
+	testutils.Writer(t, c)
+	testutils.GetValues(t, c)
+}
+
+func (s *FilterSuite) TestWriterJSON(t *C) {
+	err := ioutil.WriteFile(filepathJSON, []byte(testfileJSON), 0666)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filepathJSON)
+
+	c, _ := New(filepathJSON)
+	testutils.Writer(t, c)
+	testutils.GetValues(t, c)
+
+	data, err := ioutil.ReadFile(filepathJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	t.Check(json.Unmarshal(data, &v), IsNil)
+}
+
+func (s *FilterSuite) TestWriterNewFile(t *C) {
+	defer os.Remove(filepathYML)
+
+	c, _ := New(filepathYML)
+	t.Assert(c.Set(context.Background(), "/premtest/database/url", "www.google.de"), IsNil)
+	t.Check(c.Set(context.Background(), "/premtest/database/url/host", "google"), NotNil)
+
+	m, err := c.GetValues([]string{"/premtest"})
+	t.Assert(err, IsNil)
+	t.Check(m, DeepEquals, map[string]string{
+		"/premtest/database/url": "www.google.de",
+	})
+}
+
+func (s *FilterSuite) TestWriterList(t *C) {
+	err := ioutil.WriteFile(filepathYML, []byte(testfileYML), 0666)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filepathYML)
+
+	c, _ := New(filepathYML)
+	t.Assert(c.Set(context.Background(), "/remtest/database/hosts/2/name", "test3"), IsNil)
+	t.Check(c.Set(context.Background(), "/remtest/database/hosts/4/name", "test5"), NotNil)
+	t.Assert(c.Delete(context.Background(), "/remtest/database/hosts/0/name"), IsNil)
+	err = c.DeletePrefix(context.Background(), "/remtest/database/hosts/1")
+	t.Check(errors.Is(err, easykv.ErrInvalid), Equals, true)
+	t.Assert(c.DeletePrefix(context.Background(), "/remtest/database/hosts/2"), IsNil)
+
+	m, err := c.GetValues([]string{"/remtest"})
+	t.Assert(err, IsNil)
+	t.Check(m, DeepEquals, map[string]string{
+		"/remtest/database/hosts/0/ip":   "192.168.0.1",
+		"/remtest/database/hosts/0/size": "60",
+		"/remtest/database/hosts/1/ip":   "192.168.0.2",
+		"/remtest/database/hosts/1/name": "test2",
+		"/remtest/database/hosts/1/size": "80",
+	})
+}
+
+func (s *FilterSuite) TestWriterURL(t *C) {
+	c, _ := New("http://127.0.0.1/config.yml")
+	t.Check(c.Set(context.Background(), "/foo", "bar"), Equals, easykv.ErrWriteNotSupported)
+	t.Check(c.Delete(context.Background(), "/foo"), Equals, easykv.ErrWriteNotSupported)
+	t.Check(c.DeletePrefix(context.Background(), "/foo"), Equals, easykv.ErrWriteNotSupported)
+}
+
+func (s *FilterSuite) TestCapabilities(t *C) {
+	c, _ := New("http://127.0.0.1/config.yml")
+	t.Check(easykv.CapabilitiesOf(c), Equals, easykv.Capabilities{})
+
+	c, _ = New(filepath.Join(t.MkDir(), "config.yml"))
+	t.Check(easykv.CapabilitiesOf(c), Equals, easykv.Capabilities{Watch: true, Write: true})
+}
+
+func (s *FilterSuite) TestOpen(t *C) {
+	err := ioutil.WriteFile(filepathYML, []byte(testfileYML), 0666)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(filepathYML)
+
+	c, err := easykv.Open("file://" + filepathYML)
+	t.Assert(err, IsNil)
+	testutils.GetValues(t, c)
+
+	_, err = easykv.Open("file://host" + filepathYML)
+	t.Check(err, NotNil)
+}
+
+func (s *FilterSuite) TestOpenHTTP(t *C) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "---")
+		fmt.Fprintf(w, "path: %q\n", r.URL.Path)
+		fmt.Fprintf(w, "query: %q\n", r.URL.RawQuery)
+		for name, value := range r.Header {
+			fmt.Fprintf(w, "%s: %q\n", name, value[0])
+		}
+	}))
+	defer ts.Close()
+
+	c, err := easykv.Open("file+" + ts.URL + "/config.yml?header=X-Test-Token:Hi&v=1")
+	t.Assert(err, IsNil)
+	vals, err := c.GetValues([]string{"/"})
+	t.Assert(err, IsNil)
+	t.Check(vals["/X-Test-Token"], Equals, "Hi")
+	t.Check(vals["/path"], Equals, "/config.yml")
+	t.Check(vals["/query"], Equals, "v=1")
+}
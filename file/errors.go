@@ -0,0 +1,47 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package file
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+// wrapError marks file system and http errors with the easykv error kinds.
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, os.ErrNotExist):
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case errors.Is(err, os.ErrPermission):
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	}
+	return easykv.ClassifyError(err)
+}
+
+// statusError returns the error for an unsuccessful http response.
+func statusError(resp *http.Response) error {
+	err := fmt.Errorf("couldn't get %s: %s", resp.Request.URL, resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusGatewayTimeout:
+		return easykv.WrapError(easykv.ErrTimeout, err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	}
+	return err
+}
@@ -8,10 +8,13 @@
 
 package file
 
+import "log/slog"
+
 // Options contains all (possibly optional) values that are needed to fetch
 // JSON or YAML files (either locally or remotely).
 type Options struct {
 	Headers map[string]string
+	Logger  *slog.Logger
 }
 
 // Option configures the file client.
@@ -24,3 +27,10 @@ func WithHeaders(headers map[string]string) Option {
 		o.Headers = headers
 	}
 }
+
+// WithLogger sets the logger for watches, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
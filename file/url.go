@@ -0,0 +1,67 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package file
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("file", open)
+	easykv.Register("file+http", open)
+	easykv.Register("file+https", open)
+}
+
+// open creates a client from an url like
+//
+//	file:///etc/myapp/config.yml
+//	file+https://example.com/config.yml?header=Authorization:Bearer%20XXXX
+//
+// Every header parameter adds a header to the requests for remote files.
+// The other parameters of remote urls are sent to the server, local file urls take none.
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	if u.Scheme == "file" {
+		if u.Host != "" {
+			return nil, fmt.Errorf("file urls must not have a host, got %q", u.Host)
+		}
+		if _, err := easykv.Query(u); err != nil {
+			return nil, err
+		}
+		c, err := New(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+
+	q := u.Query()
+	headers := make(map[string]string)
+	for _, h := range q["header"] {
+		i := strings.Index(h, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid header %q, expected Name:Value", h)
+		}
+		headers[h[:i]] = strings.TrimSpace(h[i+1:])
+	}
+	q.Del("header")
+
+	remote := *u
+	remote.Scheme = strings.TrimPrefix(u.Scheme, "file+")
+	remote.RawQuery = q.Encode()
+
+	c, err := New(remote.String(), WithHeaders(headers))
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,66 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+type pingFunc func(ctx context.Context) error
+
+func (f pingFunc) Ping(ctx context.Context) error { return f(ctx) }
+
+type pingingLayer struct {
+	*layer
+	pingFunc
+}
+
+func (s *FilterSuite) TestHealthHandler(t *C) {
+	var err error
+	h := HealthHandler(pingFunc(func(ctx context.Context) error { return err }))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	t.Check(rec.Code, Equals, http.StatusOK)
+	t.Check(rec.Body.String(), Equals, "ok\n")
+
+	err = WrapError(ErrUnavailable, errors.New("connection refused"))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	t.Check(rec.Code, Equals, http.StatusServiceUnavailable)
+	t.Check(strings.Contains(rec.Body.String(), "connection refused"), Equals, true)
+}
+
+func (s *FilterSuite) TestHealthHandlerContext(t *C) {
+	h := HealthHandler(pingFunc(func(ctx context.Context) error { return ctx.Err() }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil).WithContext(ctx))
+	t.Check(rec.Code, Equals, http.StatusServiceUnavailable)
+}
+
+func (s *FilterSuite) TestLayeredPing(t *C) {
+	down := errors.New("down")
+	up := pingingLayer{newLayer(nil), func(ctx context.Context) error { return nil }}
+	rw := Layered(newLayer(nil), up)
+	t.Check(rw.(Pinger).Ping(context.Background()), IsNil)
+
+	rw = Layered(up, pingingLayer{newLayer(nil), func(ctx context.Context) error { return down }})
+	err := rw.(Pinger).Ping(context.Background())
+	t.Check(errors.Is(err, down), Equals, true)
+	t.Check(err, ErrorMatches, "layer 1: down")
+}
@@ -0,0 +1,213 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type layered struct {
+	layers []ReadWatcher
+
+	mu      sync.Mutex
+	index   uint64
+	indexes map[layeredIndex][]uint64 // returned index -> wait index of every layer
+}
+
+// layeredIndex is an index returned by WatchPrefix for prefix.
+type layeredIndex struct {
+	prefix string
+	index  uint64
+}
+
+// maxLayeredIndexes is the number of returned indexes whose layer indexes are kept for WithWaitIndex.
+const maxLayeredIndexes = 64
+
+// Layered combines several backends into one ReadWatcher.
+//
+// GetValues merges the values of all layers, later layers override the keys of earlier ones.
+// Layers that return ErrKeyNotFound are empty.
+// WatchPrefix watches every layer that supports watches and returns as soon as one of them fires.
+// Layers that return ErrWatchNotSupported are skipped, if no layer supports watches ErrWatchNotSupported is returned.
+//
+// The wait indexes of the layers aren't comparable, so WatchPrefix returns its own increasing index
+// and keeps the indexes of the layers for the last indexes it returned. A WaitIndex of 0 or one that
+// isn't kept anymore starts over with the current state of all layers: the first watch of a layer
+// only counts as a change if its values differ from the ones before the watch,
+// as some backends return their current index at once for the WaitIndex 0.
+// Close closes all layers.
+func Layered(backends ...ReadWatcher) ReadWatcher {
+	return &layered{
+		layers:  backends,
+		indexes: make(map[layeredIndex][]uint64),
+	}
+}
+
+// GetValues is used to lookup all keys with a prefix in all layers.
+func (l *layered) GetValues(keys []string) (map[string]string, error) {
+	return l.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests of the layers are bound to ctx.
+func (l *layered) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	vars := make(map[string]string)
+	for i, rw := range l.layers {
+		values, err := GetValuesContext(ctx, rw, keys)
+		if errors.Is(err, ErrKeyNotFound) {
+			// the layer has no data below the keys yet
+			continue
+		}
+		if err != nil {
+			return vars, fmt.Errorf("layer %d: %w", i, err)
+		}
+		for k, v := range values {
+			vars[k] = v
+		}
+	}
+	return vars, nil
+}
+
+type layerResponse struct {
+	layer     int
+	waitIndex uint64
+	err       error
+}
+
+// WatchPrefix watches prefix in every layer and returns when one of them reports a change.
+func (l *layered) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (uint64, error) {
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	indexes := make([]uint64, len(l.layers))
+	l.mu.Lock()
+	copy(indexes, l.indexes[layeredIndex{prefix, options.WaitIndex}])
+	l.mu.Unlock()
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// buffered, so the remaining watchers can finish after we returned
+	respChan := make(chan layerResponse, len(l.layers))
+	watch := func(i int, waitIndex uint64) {
+		go func() {
+			layerOpts := append(append([]WatchOption{}, opts...), WithWaitIndex(waitIndex))
+			waitIndex, err := l.layers[i].WatchPrefix(watchCtx, prefix, layerOpts...)
+			respChan <- layerResponse{i, waitIndex, err}
+		}()
+	}
+
+	// the values of the layers without a wait index, their first watch may only return their current index
+	seeds := make([]map[string]string, len(l.layers))
+	for i := range l.layers {
+		if indexes[i] == 0 && CapabilitiesOf(l.layers[i]).Watch {
+			values, err := l.values(ctx, i, prefix, options.Keys)
+			if err != nil {
+				return options.WaitIndex, err
+			}
+			seeds[i] = values
+		}
+		watch(i, indexes[i])
+	}
+
+	for watching := len(l.layers); watching > 0; {
+		r := <-respChan
+		if ctx.Err() != nil {
+			return options.WaitIndex, ErrWatchCanceled
+		}
+		if errors.Is(r.err, ErrWatchNotSupported) {
+			watching--
+			continue
+		}
+		if r.err != nil {
+			return options.WaitIndex, fmt.Errorf("layer %d: %w", r.layer, r.err)
+		}
+
+		if seeds[r.layer] != nil && r.waitIndex != 0 {
+			values, err := l.values(ctx, r.layer, prefix, options.Keys)
+			if err != nil {
+				return options.WaitIndex, err
+			}
+			if maps.Equal(values, seeds[r.layer]) {
+				// the current index of the layer, watch it from there
+				seeds[r.layer] = nil
+				indexes[r.layer] = r.waitIndex
+				watch(r.layer, r.waitIndex)
+				continue
+			}
+		}
+		indexes[r.layer] = r.waitIndex
+
+		l.mu.Lock()
+		l.index++
+		index := l.index
+		l.indexes[layeredIndex{prefix, index}] = indexes
+		for k := range l.indexes {
+			if k.index+maxLayeredIndexes <= index {
+				delete(l.indexes, k)
+			}
+		}
+		l.mu.Unlock()
+		return index, nil
+	}
+	return options.WaitIndex, ErrWatchNotSupported
+}
+
+// values returns the values of layer i below prefix that match keys.
+func (l *layered) values(ctx context.Context, i int, prefix string, keys []string) (map[string]string, error) {
+	values, err := GetValuesContext(ctx, l.layers[i], []string{prefix})
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("layer %d: %w", i, err)
+	}
+	matching := make(map[string]string)
+	for k, v := range values {
+		if len(keys) == 0 || slices.ContainsFunc(keys, func(key string) bool { return strings.HasPrefix(k, key) }) {
+			matching[k] = v
+		}
+	}
+	return matching, nil
+}
+
+// Close closes all layers.
+func (l *layered) Close() {
+	for _, rw := range l.layers {
+		rw.Close()
+	}
+}
+
+// Capabilities reports a watch if one of the layers supports it
+// and binary values if all layers support them. Layered is read-only.
+func (l *layered) Capabilities() Capabilities {
+	caps := Capabilities{BinaryValues: len(l.layers) > 0}
+	for _, rw := range l.layers {
+		c := CapabilitiesOf(rw)
+		caps.Watch = caps.Watch || c.Watch
+		caps.BinaryValues = caps.BinaryValues && c.BinaryValues
+	}
+	return caps
+}
+
+// Ping pings all layers that implement Pinger.
+func (l *layered) Ping(ctx context.Context) error {
+	for i, rw := range l.layers {
+		if p, ok := rw.(Pinger); ok {
+			if err := p.Ping(ctx); err != nil {
+				return fmt.Errorf("layer %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
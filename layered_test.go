@@ -0,0 +1,180 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// layer is a static ReadWatcher whose WatchPrefix fires once something is sent on fire.
+type layer struct {
+	mu         sync.Mutex
+	values     map[string]string
+	err        error
+	fire       chan uint64
+	waitIndex  chan uint64
+	closed     bool
+	noWatching bool
+	initial    uint64 // returned at once for the WaitIndex 0, like consul
+}
+
+func newLayer(values map[string]string) *layer {
+	return &layer{values: values, fire: make(chan uint64), waitIndex: make(chan uint64, 10)}
+}
+
+func (l *layer) GetValues(keys []string) (map[string]string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.values, l.err
+}
+
+func (l *layer) set(key, value string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := map[string]string{key: value}
+	for k, v := range l.values {
+		if k != key {
+			values[k] = v
+		}
+	}
+	l.values = values
+}
+
+func (l *layer) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (uint64, error) {
+	if l.noWatching {
+		return 0, ErrWatchNotSupported
+	}
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	l.waitIndex <- options.WaitIndex
+	if options.WaitIndex == 0 && l.initial > 0 {
+		return l.initial, nil
+	}
+	select {
+	case index := <-l.fire:
+		return index, nil
+	case <-ctx.Done():
+		return options.WaitIndex, ErrWatchCanceled
+	}
+}
+
+func (l *layer) Close() { l.closed = true }
+
+func (s *FilterSuite) TestLayeredGetValues(t *C) {
+	defaults := newLayer(map[string]string{"/app/port": "80", "/app/host": "localhost"})
+	overrides := newLayer(map[string]string{"/app/port": "8080"})
+	secrets := newLayer(map[string]string{"/app/password": "secret"})
+
+	rw := Layered(defaults, overrides, secrets)
+	vals, err := rw.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(vals, DeepEquals, map[string]string{
+		"/app/port":     "8080",
+		"/app/host":     "localhost",
+		"/app/password": "secret",
+	})
+
+	// a layer without data below the keys is empty
+	secrets.err = WrapError(ErrKeyNotFound, errors.New("/app"))
+	vals, err = rw.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(vals, DeepEquals, map[string]string{"/app/port": "8080", "/app/host": "localhost"})
+
+	secrets.err = ErrUnauthorized
+	_, err = rw.GetValues([]string{"/app"})
+	t.Check(errors.Is(err, ErrUnauthorized), Equals, true)
+
+	rw.Close()
+	t.Check(defaults.closed && overrides.closed && secrets.closed, Equals, true)
+}
+
+func (s *FilterSuite) TestLayeredWatchPrefix(t *C) {
+	file := newLayer(nil)
+	consul := newLayer(nil)
+	vault := newLayer(nil)
+	vault.noWatching = true
+
+	rw := Layered(file, consul, vault)
+	fired := func(l *layer, index uint64) {
+		<-file.waitIndex
+		<-consul.waitIndex
+		l.set("/app/port", strconv.FormatUint(index, 10))
+		l.fire <- index
+	}
+
+	go fired(consul, 42)
+	index, err := rw.WatchPrefix(context.Background(), "/app", WithKeys([]string{"/app"}))
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, uint64(1))
+
+	// every layer gets its own last index back
+	go fired(file, 7)
+	index, err = rw.WatchPrefix(context.Background(), "/app", WithKeys([]string{"/app"}), WithWaitIndex(index))
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, uint64(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	index, err = rw.WatchPrefix(ctx, "/app", WithKeys([]string{"/app"}), WithWaitIndex(index))
+	t.Check(err, Equals, ErrWatchCanceled)
+	t.Check(index, Equals, uint64(2))
+	t.Check(<-file.waitIndex, Equals, uint64(7))
+	t.Check(<-consul.waitIndex, Equals, uint64(42))
+}
+
+func (s *FilterSuite) TestLayeredWatchInitialIndex(t *C) {
+	file := newLayer(nil)
+	consul := newLayer(map[string]string{"/app/port": "80"})
+	consul.initial = 42
+
+	rw := Layered(file, consul)
+	go func() {
+		<-file.waitIndex
+		// the current index of consul isn't a change, it is watched from there
+		<-consul.waitIndex
+		<-consul.waitIndex
+		file.set("/app/port", "8080")
+		file.fire <- 7
+	}()
+	index, err := rw.WatchPrefix(context.Background(), "/app")
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, uint64(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = rw.WatchPrefix(ctx, "/app", WithWaitIndex(index))
+	t.Check(err, Equals, ErrWatchCanceled)
+	t.Check(<-file.waitIndex, Equals, uint64(7))
+	t.Check(<-consul.waitIndex, Equals, uint64(42))
+
+	// the WaitIndex 0 starts over, consul only returns its index
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = rw.WatchPrefix(ctx, "/app")
+	t.Check(err, Equals, ErrWatchCanceled)
+	t.Check(<-file.waitIndex, Equals, uint64(0))
+	t.Check(<-consul.waitIndex, Equals, uint64(0))
+	t.Check(<-consul.waitIndex, Equals, uint64(42))
+}
+
+func (s *FilterSuite) TestLayeredWatchNotSupported(t *C) {
+	env := newLayer(nil)
+	env.noWatching = true
+
+	_, err := Layered(env).WatchPrefix(context.Background(), "/app")
+	t.Check(err, Equals, ErrWatchNotSupported)
+}
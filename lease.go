@@ -0,0 +1,93 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval is the shortest interval between two refreshes of a lease.
+const minRefreshInterval = time.Millisecond
+
+// CheckTTL returns an error marked as ErrInvalid if ttl isn't positive.
+// It is called by the SetWithTTL methods of the backends.
+func CheckTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl %v isn't positive", ErrInvalid, ttl)
+	}
+	return nil
+}
+
+// NewLease returns a Lease for backends whose TTLs have to be renewed by the client.
+// refresh is called every ttl/3, but at most every millisecond, until the lease is closed. A failing refresh is retried until ttl passed
+// since the last successful one, the lease ends at once if refresh returns an ErrKeyNotFound.
+// Close stops the refreshing and calls release.
+func NewLease(ttl time.Duration, refresh, release func(ctx context.Context) error) Lease {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &lease{
+		cancel:  cancel,
+		release: release,
+		done:    make(chan struct{}),
+	}
+	go l.keepAlive(ctx, ttl, refresh)
+	return l
+}
+
+type lease struct {
+	cancel  context.CancelFunc
+	release func(ctx context.Context) error
+	done    chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+func (l *lease) keepAlive(ctx context.Context, ttl time.Duration, refresh func(ctx context.Context) error) {
+	defer close(l.done)
+
+	interval := ttl / 3
+	if interval < minRefreshInterval {
+		interval = minRefreshInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := refresh(ctx)
+		switch {
+		case err == nil:
+			last = time.Now()
+		case errors.Is(err, ErrKeyNotFound), time.Since(last) > ttl:
+			return
+		}
+	}
+}
+
+func (l *lease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *lease) Close() error {
+	l.once.Do(func() {
+		l.cancel()
+		<-l.done
+		l.err = l.release(context.Background())
+	})
+	return l.err
+}
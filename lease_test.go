@@ -0,0 +1,95 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *FilterSuite) TestLeaseRefresh(t *C) {
+	var refreshed, released int32
+	l := NewLease(30*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&refreshed, 1)
+		return nil
+	}, func(ctx context.Context) error {
+		atomic.AddInt32(&released, 1)
+		return nil
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-l.Done():
+		t.Fatal("lease ended while it was refreshed")
+	default:
+	}
+	t.Check(atomic.LoadInt32(&refreshed) >= 2, Equals, true)
+
+	t.Check(l.Close(), IsNil)
+	t.Check(l.Close(), IsNil)
+	t.Check(atomic.LoadInt32(&released), Equals, int32(1))
+	<-l.Done()
+}
+
+func (s *FilterSuite) TestLeaseExpired(t *C) {
+	l := NewLease(30*time.Millisecond, func(ctx context.Context) error {
+		return WrapError(ErrKeyNotFound, errors.New("key is gone"))
+	}, func(ctx context.Context) error {
+		return nil
+	})
+
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease wasn't ended")
+	}
+	t.Check(l.Close(), IsNil)
+}
+
+func (s *FilterSuite) TestLeaseRetry(t *C) {
+	failure := errors.New("unavailable")
+	var calls int32
+	l := NewLease(60*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return failure
+	}, func(ctx context.Context) error {
+		return failure
+	})
+
+	select {
+	case <-l.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease wasn't ended")
+	}
+	// the refresh is retried until the ttl passed
+	t.Check(atomic.LoadInt32(&calls) >= 3, Equals, true)
+	t.Check(l.Close(), Equals, failure)
+}
+
+func (s *FilterSuite) TestLeaseShortTTL(t *C) {
+	t.Check(errors.Is(CheckTTL(0), ErrInvalid), Equals, true)
+	t.Check(errors.Is(CheckTTL(-time.Second), ErrInvalid), Equals, true)
+	t.Check(CheckTTL(time.Nanosecond), IsNil)
+
+	// ttl/3 is 0, the refresh interval is raised instead of panicking in time.NewTicker
+	var refreshed int32
+	l := NewLease(time.Nanosecond, func(ctx context.Context) error {
+		atomic.AddInt32(&refreshed, 1)
+		return nil
+	}, func(ctx context.Context) error {
+		return nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	t.Check(l.Close(), IsNil)
+	t.Check(atomic.LoadInt32(&refreshed) > 0, Equals, true)
+}
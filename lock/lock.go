@@ -0,0 +1,55 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+// Package lock defines distributed locks and leader elections.
+// They are implemented by the clients of the etcdv3, consul and zookeeper backends:
+//
+//	c, err := etcdv3.NewEtcdClient(...)
+//	l, err := c.Lock(ctx, "/locks/migration")
+//	defer l.Unlock(context.Background())
+package lock
+
+import "context"
+
+// A Locker - can acquire distributed locks
+//
+// Lock blocks until the lock key is acquired or ctx is done.
+type Locker interface {
+	Lock(ctx context.Context, key string) (Lock, error)
+}
+
+// Lock is a held lock.
+type Lock interface {
+	// Unlock releases the lock.
+	Unlock(ctx context.Context) error
+	// Done is closed when the lock is lost, e.g. because the session of the client expired,
+	// or when it was released.
+	Done() <-chan struct{}
+}
+
+// An Elector - can run leader elections
+//
+// Election returns a candidate for the election key.
+type Elector interface {
+	Election(key string) Election
+}
+
+// Election is a candidate of a leader election.
+// All candidates of an election use the same key.
+type Election interface {
+	// Campaign blocks until the candidate is elected leader or ctx is done.
+	// The value is announced to the observers of the election.
+	Campaign(ctx context.Context, value string) error
+	// Resign gives up the leadership, so another candidate is elected.
+	// It does nothing if the candidate isn't the leader.
+	Resign(ctx context.Context) error
+	// Done is closed when the leadership won by the last Campaign ends.
+	Done() <-chan struct{}
+	// Observe sends the value of every new leader until ctx is done.
+	Observe(ctx context.Context) <-chan string
+}
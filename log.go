@@ -0,0 +1,36 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// BackendLogger returns logger with the backend attribute set.
+// A nil logger discards all records, which is the default of all backends.
+func BackendLogger(logger *slog.Logger, backend string) *slog.Logger {
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	return logger.With("backend", backend)
+}
+
+// LogWatch logs the result of a WatchPrefix call.
+// Fired and canceled watches are logged at debug level, all other errors at error level.
+func LogWatch(logger *slog.Logger, prefix string, index uint64, err error) {
+	switch {
+	case err == nil:
+		logger.Debug("watch fired", "prefix", prefix, "index", index)
+	case errors.Is(err, ErrWatchCanceled):
+		logger.Debug("watch stopped", "prefix", prefix, "index", index)
+	default:
+		logger.Error("watch failed", "prefix", prefix, "index", index, "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+
+	. "gopkg.in/check.v1"
+)
+
+func (s *FilterSuite) TestBackendLogger(t *C) {
+	var buf bytes.Buffer
+	logger := BackendLogger(slog.New(slog.NewTextHandler(&buf, nil)), "consul")
+	logger.Info("connected")
+	t.Check(strings.Contains(buf.String(), "backend=consul"), Equals, true)
+
+	// a nil logger discards the records
+	BackendLogger(nil, "consul").Error("dropped")
+}
+
+func (s *FilterSuite) TestLogWatch(t *C) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	LogWatch(logger, "/app", 3, nil)
+	t.Check(buf.String(), Matches, `(?s).*level=DEBUG msg="watch fired" prefix=/app index=3\n`)
+
+	buf.Reset()
+	LogWatch(logger, "/app", 3, ErrWatchCanceled)
+	t.Check(buf.String(), Matches, `(?s).*level=DEBUG msg="watch stopped" prefix=/app index=3\n`)
+
+	buf.Reset()
+	LogWatch(logger, "/app", 3, errors.New("connection refused"))
+	t.Check(buf.String(), Matches, `(?s).*level=ERROR msg="watch failed" prefix=/app index=3 error="connection refused"\n`)
+}
@@ -0,0 +1,468 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+// Package memkv is an in-memory backend with revisions and watches.
+// It is meant for tests that exercise watch-driven code without an external service.
+package memkv
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+// MaxHistory is the number of changes that are kept to serve WithWaitIndex.
+const MaxHistory = 1024
+
+// ErrCompacted is sent by Watch if the changes after the requested wait index aren't kept anymore.
+var ErrCompacted = errors.New("memkv: required revision has been compacted")
+
+// Client is an in-memory key-value store.
+// Every change increases the revision of the store by one.
+type Client struct {
+	mu        sync.Mutex
+	revision  uint64
+	compacted uint64 // changes up to this revision aren't in history
+	values    map[string]*kv
+	history   []easykv.Event
+	changed   chan struct{} // closed and replaced on every change
+	logger    *slog.Logger
+}
+
+type kv struct {
+	value          string
+	createRevision uint64
+	modRevision    uint64
+	version        uint64
+	modified       time.Time
+	lease          uint64 // 0 if the key isn't bound to a lease
+	expires        time.Time
+}
+
+// New returns an *memkv.Client filled with data.
+// All keys of data are created with revision 1.
+func New(data map[string]string, opts ...Option) (*Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c := &Client{
+		values:  make(map[string]*kv, len(data)),
+		changed: make(chan struct{}),
+		logger:  easykv.BackendLogger(options.Logger, "memkv"),
+	}
+	if len(data) > 0 {
+		c.revision = 1
+		c.compacted = 1
+	}
+	now := time.Now()
+	for k, v := range data {
+		c.values[k] = &kv{value: v, createRevision: 1, modRevision: 1, version: 1, modified: now}
+	}
+	return c, nil
+}
+
+// Close is only meant to fulfill the easykv.ReadWatcher interface.
+// Does nothing.
+func (c *Client) Close() {}
+
+// Revision returns the current revision of the store.
+func (c *Client) Revision() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.revision
+}
+
+// GetValues is used to lookup all keys with a prefix.
+// Several prefixes can be specified in the keys array.
+func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but fails if ctx is already done.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	vars := make(map[string]string)
+	for _, prefix := range keys {
+		for k, v := range c.values {
+			if strings.HasPrefix(k, prefix) {
+				vars[k] = v.value
+			}
+		}
+	}
+	return vars, nil
+}
+
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := []easykv.Entry{}
+	for k, v := range c.values {
+		for _, prefix := range keys {
+			if strings.HasPrefix(k, prefix) {
+				e := easykv.Entry{
+					Key:            k,
+					Value:          []byte(v.value),
+					Revision:       v.modRevision,
+					CreateRevision: v.createRevision,
+					Version:        v.version,
+					ModifyTime:     v.modified,
+				}
+				if v.lease != 0 {
+					e.Lease = strconv.FormatUint(v.lease, 10)
+					e.TTL = time.Until(v.expires)
+				}
+				list = append(list, e)
+				break
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// GetSnapshot returns the values of all prefixes in keys at the current revision.
+func (c *Client) GetSnapshot(ctx context.Context, keys []string) (easykv.Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return easykv.Snapshot{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	snap := easykv.Snapshot{Revision: c.revision, Values: make(map[string]string)}
+	for _, prefix := range keys {
+		for k, v := range c.values {
+			if strings.HasPrefix(k, prefix) {
+				snap.Values[k] = v.value
+			}
+		}
+	}
+	return snap, nil
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revision++
+	c.put(key, value)
+	return nil
+}
+
+// put sets the value of key with the current revision.
+// c.mu must be held.
+func (c *Client) put(key, value string) {
+	v, ok := c.values[key]
+	if !ok {
+		v = &kv{createRevision: c.revision}
+		c.values[key] = v
+	}
+	v.value = value
+	v.modRevision = c.revision
+	v.version++
+	v.modified = time.Now()
+	v.lease = 0
+	c.record(easykv.Event{Key: key, Value: value, Type: easykv.EventPut, Revision: c.revision})
+}
+
+// SetWithTTL sets the value of key and removes it after ttl unless the lease is kept alive.
+// Setting the key again without a TTL detaches it from the lease.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.revision++
+	c.put(key, value)
+	v := c.values[key]
+	id := c.revision
+	v.lease = id
+	v.expires = time.Now().Add(ttl)
+	c.mu.Unlock()
+
+	timer := time.AfterFunc(ttl, func() { c.expire(key, id, false) })
+	refresh := func(ctx context.Context) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if v, ok := c.values[key]; !ok || v.lease != id {
+			return easykv.ErrKeyNotFound
+		}
+		v.expires = time.Now().Add(ttl)
+		timer.Reset(ttl)
+		return nil
+	}
+	release := func(ctx context.Context) error {
+		timer.Stop()
+		c.expire(key, id, true)
+		return nil
+	}
+	return easykv.NewLease(ttl, refresh, release), nil
+}
+
+// expire removes key if it is still bound to the lease id.
+// Unless released is set, a key whose lease was refreshed after the timer fired is kept,
+// as the refresh reset the timer.
+func (c *Client) expire(key string, id uint64, released bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok || v.lease != id {
+		return
+	}
+	if !released && time.Now().Before(v.expires) {
+		return
+	}
+	c.revision++
+	delete(c.values, key)
+	c.record(easykv.Event{Key: key, Type: easykv.EventDelete, Revision: c.revision})
+}
+
+// CompareAndSwap sets the value of key if its revision is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return c.Commit(ctx, []easykv.Compare{{Key: key, Revision: revision}}, []easykv.TxnOp{easykv.PutOp(key, value)})
+}
+
+// Commit applies all ops with the same revision if all cmps hold.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, cmp := range cmps {
+		var revision uint64
+		if v, ok := c.values[cmp.Key]; ok {
+			revision = v.modRevision
+		}
+		if revision != cmp.Revision {
+			return &easykv.ConflictError{Key: cmp.Key}
+		}
+	}
+
+	bumped := false
+	for _, op := range ops {
+		if _, ok := c.values[op.Key]; op.Delete && !ok {
+			continue
+		}
+		if !bumped {
+			c.revision++
+			bumped = true
+		}
+		if op.Delete {
+			delete(c.values, op.Key)
+			c.record(easykv.Event{Key: op.Key, Type: easykv.EventDelete, Revision: c.revision})
+			continue
+		}
+		c.put(op.Key, op.Value)
+	}
+	return nil
+}
+
+// Delete removes key.
+// Deleting a missing key is not an error and doesn't change the revision.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; !ok {
+		return nil
+	}
+	c.revision++
+	delete(c.values, key)
+	c.record(easykv.Event{Key: key, Type: easykv.EventDelete, Revision: c.revision})
+	return nil
+}
+
+// DeletePrefix removes all keys with the given prefix.
+// All keys are deleted with the same revision.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for k := range c.values {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	c.revision++
+	for _, k := range keys {
+		delete(c.values, k)
+		c.record(easykv.Event{Key: k, Type: easykv.EventDelete, Revision: c.revision})
+	}
+	return nil
+}
+
+// record appends e to the history and wakes up all watchers.
+// c.mu must be held.
+func (c *Client) record(e easykv.Event) {
+	c.history = append(c.history, e)
+	if n := len(c.history) - MaxHistory; n > 0 {
+		c.compacted = c.history[n-1].Revision
+		c.history = append(c.history[:0:0], c.history[n:]...)
+	}
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// changes returns the changes after revision below prefix that match keys,
+// the current revision and a channel that is closed on the next change.
+// ok is false if the changes after revision aren't kept anymore.
+func (c *Client) changes(revision uint64, prefix string, keys []string) (events []easykv.Event, current uint64, changed <-chan struct{}, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if revision < c.compacted {
+		return nil, c.revision, c.changed, false
+	}
+	for _, e := range c.history {
+		if e.Revision > revision && strings.HasPrefix(e.Key, prefix) && matchKeys(e.Key, keys) {
+			events = append(events, e)
+		}
+	}
+	return events, c.revision, c.changed, true
+}
+
+// WatchPrefix waits for a change below prefix that matches WithKeys and returns its revision.
+// WithWaitIndex returns the first change after the given revision, even if it happened before the call.
+// If those changes aren't kept anymore, the current revision is returned at once.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
+	revision := options.WaitIndex
+	if revision == 0 {
+		revision = c.Revision()
+	}
+
+	for {
+		events, current, changed, ok := c.changes(revision, prefix, options.Keys)
+		if !ok {
+			return current, nil
+		}
+		if len(events) > 0 {
+			return events[0].Revision, nil
+		}
+		revision = current
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return options.WaitIndex, easykv.ErrWatchCanceled
+		}
+	}
+}
+
+// Watch streams all changes below prefix.
+// WithWaitIndex replays the kept changes after the given revision.
+func (c *Client) Watch(ctx context.Context, prefix string, opts ...easykv.WatchOption) (<-chan easykv.Event, error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	revision := options.WaitIndex
+	if revision == 0 {
+		revision = c.Revision()
+	}
+
+	out := make(chan easykv.Event)
+	go func() {
+		defer close(out)
+		for {
+			events, current, changed, ok := c.changes(revision, prefix, options.Keys)
+			if !ok {
+				events = []easykv.Event{{Err: ErrCompacted}}
+			}
+			for _, e := range events {
+				select {
+				case out <- e:
+				case <-ctx.Done():
+					return
+				}
+				if e.Err != nil {
+					return
+				}
+			}
+			revision = current
+
+			select {
+			case <-changed:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// matchKeys reports whether key starts with one of keys.
+// An empty keys slice matches every key.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports that memkv supports all features.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Transactions: true, Revisions: true, BinaryValues: true}
+}
+
+// Ping only fails if ctx is done, memkv is always reachable.
+func (c *Client) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
@@ -0,0 +1,218 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package memkv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/HeavyHorst/easykv/testutils"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New(nil)
+		t.Assert(err, IsNil)
+		return c
+	},
+})
+
+var testdata = map[string]string{
+	"/premtest/database/url":         "www.google.de",
+	"/premtest/database/user":        "Boris",
+	"/remtest/database/hosts/0/name": "test1",
+	"/remtest/database/hosts/0/ip":   "192.168.0.1",
+	"/remtest/database/hosts/0/size": "60",
+	"/remtest/database/hosts/1/name": "test2",
+	"/remtest/database/hosts/1/ip":   "192.168.0.2",
+	"/remtest/database/hosts/1/size": "80",
+	"/other/key":                     "value",
+}
+
+func (s *FilterSuite) TestGetValues(t *C) {
+	c, _ := New(testdata)
+	err := testutils.GetValues(t, c)
+	t.Check(err, IsNil)
+	testutils.GetValuesContext(t, c)
+}
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, _ := New(nil)
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestWatch(t *C) {
+	c, _ := New(nil)
+	testutils.Watch(t, c)
+}
+
+func (s *FilterSuite) TestRevision(t *C) {
+	c, _ := New(testdata)
+	t.Check(c.Revision(), Equals, uint64(1))
+
+	ctx := context.Background()
+	c.Set(ctx, "/a", "1")
+	c.Set(ctx, "/a", "2")
+	t.Check(c.Revision(), Equals, uint64(3))
+
+	// deleting a missing key doesn't change the store
+	c.Delete(ctx, "/missing")
+	t.Check(c.Revision(), Equals, uint64(3))
+
+	// one revision for all deleted keys
+	c.DeletePrefix(ctx, "/remtest")
+	t.Check(c.Revision(), Equals, uint64(4))
+}
+
+func (s *FilterSuite) TestWatchPrefix(t *C) {
+	c, _ := New(testdata)
+	ctx := context.Background()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.Set(ctx, "/premtest/database/port", "5432")
+		c.Set(ctx, "/premtest/database/url", "www.google.com")
+	}()
+	index := testutils.WatchPrefix(ctx, t, c, "/premtest", []string{"/premtest/database/url"})
+	t.Check(index, Equals, uint64(3))
+
+	// changes after the wait index are returned, even if they happened before the call
+	c.Set(ctx, "/other/key", "changed")
+	c.Set(ctx, "/premtest/database/user", "Jan")
+	index, err := c.WatchPrefix(ctx, "/premtest", easykv.WithWaitIndex(index), easykv.WithKeys([]string{"/premtest/database"}))
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, uint64(5))
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	index, err = c.WatchPrefix(ctx, "/premtest", easykv.WithWaitIndex(index), easykv.WithKeys([]string{"/premtest"}))
+	t.Check(err, Equals, easykv.ErrWatchCanceled)
+	t.Check(index, Equals, uint64(5))
+}
+
+func (s *FilterSuite) TestWatchPrefixLogger(t *C) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c, _ := New(testdata, WithLogger(logger))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := c.WatchPrefix(ctx, "/premtest")
+	t.Check(err, Equals, easykv.ErrWatchCanceled)
+
+	t.Check(strings.Contains(buf.String(), `msg="watch started" backend=memkv prefix=/premtest`), Equals, true)
+	t.Check(strings.Contains(buf.String(), `msg="watch stopped" backend=memkv prefix=/premtest`), Equals, true)
+}
+
+func (s *FilterSuite) TestWatchCompacted(t *C) {
+	c, _ := New(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < MaxHistory+10; i++ {
+		c.Set(ctx, "/key", fmt.Sprint(i))
+	}
+
+	index, err := c.WatchPrefix(ctx, "/key", easykv.WithWaitIndex(1))
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, c.Revision())
+
+	events, err := c.Watch(ctx, "/key", easykv.WithWaitIndex(1))
+	t.Assert(err, IsNil)
+	e := <-events
+	t.Check(e.Err, Equals, ErrCompacted)
+	_, ok := <-events
+	t.Check(ok, Equals, false)
+
+	// the kept changes are replayed
+	events, err = c.Watch(ctx, "/key", easykv.WithWaitIndex(c.Revision()-1))
+	t.Assert(err, IsNil)
+	e = <-events
+	t.Check(e.Revision, Equals, c.Revision())
+	t.Check(e.Value, Equals, fmt.Sprint(MaxHistory+9))
+}
+
+func (s *FilterSuite) TestOpen(t *C) {
+	c, err := easykv.Open("memkv://")
+	t.Assert(err, IsNil)
+	t.Check(c, FitsTypeOf, &Client{})
+
+	_, err = easykv.Open("memkv://host/path")
+	t.Check(err, NotNil)
+}
+
+func (s *FilterSuite) TestSetWithZeroTTL(t *C) {
+	c, _ := New(nil)
+	_, err := c.SetWithTTL(context.Background(), "/k", "v", 0)
+	t.Check(errors.Is(err, easykv.ErrInvalid), Equals, true)
+	m, _ := c.GetValues([]string{"/k"})
+	t.Check(m, HasLen, 0)
+}
+
+func (s *FilterSuite) TestSetWithTTL(t *C) {
+	c, _ := New(nil)
+	ctx := context.Background()
+
+	lease, err := c.SetWithTTL(ctx, "/instances/a", "up", 60*time.Millisecond)
+	t.Assert(err, IsNil)
+	entries, err := c.GetEntries(ctx, []string{"/instances/a"})
+	t.Assert(err, IsNil)
+	t.Assert(entries, HasLen, 1)
+	t.Check(entries[0].Lease, Not(Equals), "")
+	t.Check(entries[0].TTL > 0, Equals, true)
+
+	// the key outlives its ttl while the lease is kept alive
+	time.Sleep(150 * time.Millisecond)
+	m, _ := c.GetValues([]string{"/instances"})
+	t.Check(m, DeepEquals, map[string]string{"/instances/a": "up"})
+
+	// a plain Set detaches the key from the lease
+	t.Assert(c.Set(ctx, "/instances/a", "static"), IsNil)
+	<-lease.Done()
+	t.Check(lease.Close(), IsNil)
+	m, _ = c.GetValues([]string{"/instances"})
+	t.Check(m, DeepEquals, map[string]string{"/instances/a": "static"})
+}
+
+func (s *FilterSuite) TestExpireRefreshed(t *C) {
+	c, _ := New(nil)
+	ctx := context.Background()
+
+	lease, err := c.SetWithTTL(ctx, "/instances/a", "up", time.Minute)
+	t.Assert(err, IsNil)
+	defer lease.Close()
+	entries, err := c.GetEntries(ctx, []string{"/instances/a"})
+	t.Assert(err, IsNil)
+	id, _ := strconv.ParseUint(entries[0].Lease, 10, 64)
+
+	// a timer that fired before the last refresh doesn't remove the key
+	c.expire("/instances/a", id, false)
+	m, _ := c.GetValues([]string{"/instances"})
+	t.Check(m, DeepEquals, map[string]string{"/instances/a": "up"})
+
+	t.Assert(lease.Close(), IsNil)
+	m, _ = c.GetValues([]string{"/instances"})
+	t.Check(m, HasLen, 0)
+}
@@ -0,0 +1,35 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package memkv
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("memkv", open)
+}
+
+// open creates an empty store from the url memkv://
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	if u.Host != "" || (u.Path != "" && u.Path != "/") {
+		return nil, fmt.Errorf("memkv urls must not have a host or path, got %q", u.Host+u.Path)
+	}
+	if _, err := easykv.Query(u); err != nil {
+		return nil, err
+	}
+	c, err := New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -16,12 +16,17 @@ import (
 )
 
 // Client is the mock client
+//
+// Deprecated: GetValues ignores the requested keys and WatchPrefix only sleeps.
+// Use the memkv package, which filters prefixes, implements Writer and fires watches on changes.
 type Client struct {
 	Err  error
 	Data map[string]string
 }
 
 // New creates a new mock client, err will be returned by all methods
+//
+// Deprecated: use memkv.New.
 func New(err error, data map[string]string) (*Client, error) {
 	return &Client{
 		Err:  err,
@@ -34,6 +39,14 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 	return c.Data, c.Err
 }
 
+// GetValuesContext mock
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.Data, c.Err
+}
+
 // Close mock
 func (c *Client) Close() {}
 
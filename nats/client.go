@@ -10,8 +10,12 @@ package nats
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/HeavyHorst/easykv"
 	"github.com/nats-io/nats.go"
@@ -24,6 +28,8 @@ type Client struct {
 	nc *nats.Conn
 	kv nats.KeyValue
 
+	logger *slog.Logger
+
 	revisionMap map[string]uint64
 }
 
@@ -38,7 +44,16 @@ func New(nodes []string, bucket string, opts ...Option) (*Client, error) {
 		nodes = append(nodes, nats.DefaultURL)
 	}
 
-	natsOptions := []nats.Option{nats.MaxReconnects(-1)}
+	logger := easykv.BackendLogger(options.Logger, "nats")
+	natsOptions := []nats.Option{
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(nc *nats.Conn, err error) {
+			logger.Warn("disconnected", "error", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			logger.Info("reconnected", "url", nc.ConnectedUrlRedacted())
+		}),
+	}
 
 	// override authentication, if any was specified
 	if options.Auth.Username != "" && options.Auth.Password != "" {
@@ -55,22 +70,25 @@ func New(nodes []string, bucket string, opts ...Option) (*Client, error) {
 
 	nc, err := nats.Connect(strings.Join(nodes, ","), natsOptions...)
 	if err != nil {
-		return nil, fmt.Errorf("could't connect to nats: %w", err)
+		logger.Error("connect failed", "error", err)
+		return nil, fmt.Errorf("could't connect to nats: %w", wrapError(err))
 	}
+	logger.Debug("connected", "url", nc.ConnectedUrlRedacted(), "bucket", bucket)
 
 	js, err := nc.JetStream()
 	if err != nil {
-		return nil, fmt.Errorf("could't initialize jetstream: %w", err)
+		return nil, fmt.Errorf("could't initialize jetstream: %w", wrapError(err))
 	}
 
 	kv, err := js.KeyValue(bucket)
 	if err != nil {
-		return nil, fmt.Errorf("could't open kv bucket: %w", err)
+		return nil, fmt.Errorf("could't open kv bucket: %w", wrapError(err))
 	}
 
 	return &Client{
 		nc:          nc,
 		kv:          kv,
+		logger:      logger,
 		revisionMap: make(map[string]uint64),
 	}, nil
 }
@@ -86,6 +104,11 @@ func clean(key string) string {
 	return cleanReplacer.Replace(newKey)
 }
 
+func natsKey(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	return strings.ReplaceAll(key, "/", ".")
+}
+
 func getWatchKey(prefix string) string {
 	prefix = strings.ReplaceAll(prefix, "/", ".")
 	prefix = strings.TrimPrefix(prefix, ".")
@@ -100,9 +123,15 @@ func getWatchKey(prefix string) string {
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
-	allKeys, err := c.kv.Keys()
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the key listing is bound to ctx
+// and ctx is checked before every single get.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	allKeys, err := c.kv.Keys(nats.Context(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("couldn't get keys: %w", err)
+		return nil, fmt.Errorf("couldn't get keys: %w", wrapError(err))
 	}
 
 	// filter keys
@@ -117,9 +146,12 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 
 	vars := make(map[string]string)
 	for _, key := range filteredKeys {
+		if err := ctx.Err(); err != nil {
+			return nil, wrapError(err)
+		}
 		val, err := c.kv.Get(key)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't get key: %v %w", key, err)
+			return nil, fmt.Errorf("couldn't get key: %v %w", key, wrapError(err))
 		}
 		vars[clean(key)] = string(val.Value())
 	}
@@ -127,29 +159,309 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 	return vars, nil
 }
 
-// WatchPrefix
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+// The revisions are the sequence numbers of the stream behind the bucket.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	allKeys, err := c.kv.Keys(nats.Context(ctx))
+	if err == nats.ErrNoKeysFound {
+		return []easykv.Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get keys: %w", wrapError(err))
+	}
+
+	list := []easykv.Entry{}
+	for _, k := range allKeys {
+		if !hasPrefix(clean(k), keys) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, wrapError(err)
+		}
+		entry, err := c.kv.Get(k)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get key: %v %w", k, wrapError(err))
+		}
+		list = append(list, easykv.Entry{
+			Key:        clean(k),
+			Value:      entry.Value(),
+			Revision:   entry.Revision(),
+			ModifyTime: entry.Created(),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// SnapshotAttempts is the number of reads of GetSnapshot before it gives up on a busy bucket.
+const SnapshotAttempts = 5
+
+// snapshotBackoff is the wait before the second read of GetSnapshot, it doubles with every further read.
+const snapshotBackoff = 10 * time.Millisecond
+
+// GetSnapshot returns the values of all prefixes in keys at a single revision.
+// The last sequence number of the bucket is compared before and after reading the values,
+// the read is retried with a backoff until no change happened in between.
+// A *easykv.ConflictError is returned if the bucket changed during all SnapshotAttempts reads.
+func (c *Client) GetSnapshot(ctx context.Context, keys []string) (easykv.Snapshot, error) {
+	backoff := snapshotBackoff
+	for attempt := 0; attempt < SnapshotAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return easykv.Snapshot{}, wrapError(ctx.Err())
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		before, err := c.lastSeq(ctx)
+		if err != nil {
+			return easykv.Snapshot{}, err
+		}
+
+		values, err := c.GetValuesContext(ctx, keys)
+		if errors.Is(err, nats.ErrNoKeysFound) {
+			values, err = map[string]string{}, nil
+		}
+		if err != nil {
+			return easykv.Snapshot{}, err
+		}
+
+		after, err := c.lastSeq(ctx)
+		if err != nil {
+			return easykv.Snapshot{}, err
+		}
+		if before == after {
+			return easykv.Snapshot{Revision: after, Values: values}, nil
+		}
+	}
+	return easykv.Snapshot{}, fmt.Errorf("the bucket changed during %d snapshot reads: %w", SnapshotAttempts, &easykv.ConflictError{})
+}
+
+// lastSeq returns the sequence number of the last change in the bucket.
+func (c *Client) lastSeq(ctx context.Context) (uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, wrapError(err)
+	}
+	status, err := c.kv.Status()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get bucket status: %w", wrapError(err))
+	}
+	if s, ok := status.(*nats.KeyValueBucketStatus); ok {
+		return s.StreamInfo().State.LastSeq, nil
+	}
+	return 0, fmt.Errorf("couldn't get bucket status: unknown status type %T", status)
+}
+
+// hasPrefix reports whether key starts with one of prefixes.
+func hasPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Set sets the value of key.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	// the puts of the nats client take no context
+	if err := ctx.Err(); err != nil {
+		return wrapError(err)
+	}
+	if _, err := c.kv.PutString(natsKey(key), value); err != nil {
+		return fmt.Errorf("couldn't put key: %v %w", key, wrapError(err))
+	}
+	return nil
+}
+
+// SetWithTTL sets the value of key and puts it again until the lease is closed.
+// nats KV has no TTLs per key, the TTL of the bucket applies instead of ttl
+// and ErrNoBucketTTL is returned if the bucket has none.
+// Every refresh is a new revision of key, watchers see it as a change.
+// The lease ends when key is changed, closing it deletes key unless it was changed.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	status, err := c.kv.Status()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get bucket status: %w", wrapError(err))
+	}
+	if status.TTL() == 0 {
+		return nil, ErrNoBucketTTL
+	}
+
+	revision, err := c.kv.PutString(natsKey(key), value)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't put key: %v %w", key, wrapError(err))
+	}
+
+	refresh := func(ctx context.Context) error {
+		rev, err := c.kv.Update(natsKey(key), []byte(value), revision)
+		if errors.Is(err, nats.ErrKeyExists) {
+			return easykv.WrapError(easykv.ErrKeyNotFound, err)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't put key: %v %w", key, wrapError(err))
+		}
+		revision = rev
+		return nil
+	}
+	release := func(ctx context.Context) error {
+		err := c.kv.Delete(natsKey(key), nats.LastRevision(revision))
+		if err != nil && !errors.Is(err, nats.ErrKeyExists) {
+			return fmt.Errorf("couldn't delete key: %v %w", key, wrapError(err))
+		}
+		return nil
+	}
+	return easykv.NewLease(status.TTL(), refresh, release), nil
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(err)
+	}
+	if err := c.kv.Delete(natsKey(key)); err != nil {
+		return fmt.Errorf("couldn't delete key: %v %w", key, wrapError(err))
+	}
+	return nil
+}
+
+// DeletePrefix removes all keys with the given prefix.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	allKeys, err := c.kv.Keys(nats.Context(ctx))
+	if err == nats.ErrNoKeysFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't get keys: %w", wrapError(err))
+	}
+
+	for _, k := range allKeys {
+		if strings.HasPrefix(clean(k), prefix) {
+			if err := ctx.Err(); err != nil {
+				return wrapError(err)
+			}
+			if err := c.kv.Delete(k); err != nil {
+				return fmt.Errorf("couldn't delete key: %v %w", k, wrapError(err))
+			}
+		}
+	}
+	return nil
+}
+
+// CompareAndSwap sets the value of key if its revision is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return c.Commit(ctx, []easykv.Compare{{Key: key, Revision: revision}}, []easykv.TxnOp{easykv.PutOp(key, value)})
+}
+
+// Commit applies a single op if the revision of its key matches.
+// nats KV has no multi-key transactions, ErrMultiKeyTxn is returned if cmps and ops touch more than one key.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(err)
+	}
+	if len(ops) > 1 || len(cmps) > 1 || (len(ops) == 1 && len(cmps) == 1 && ops[0].Key != cmps[0].Key) {
+		return ErrMultiKeyTxn
+	}
+
+	if len(ops) == 0 {
+		for _, cmp := range cmps {
+			revision, err := c.revision(cmp.Key)
+			if err != nil {
+				return err
+			}
+			if revision != cmp.Revision {
+				return &easykv.ConflictError{Key: cmp.Key}
+			}
+		}
+		return nil
+	}
+
+	op := ops[0]
+	if len(cmps) == 0 {
+		if op.Delete {
+			return c.Delete(ctx, op.Key)
+		}
+		return c.Set(ctx, op.Key, op.Value)
+	}
+
+	var err error
+	revision := cmps[0].Revision
+	switch {
+	case op.Delete && revision == 0:
+		// there is nothing to delete, only check that the key doesn't exist
+		return c.Commit(ctx, cmps, nil)
+	case op.Delete:
+		err = c.kv.Delete(natsKey(op.Key), nats.LastRevision(revision))
+	case revision == 0:
+		_, err = c.kv.Create(natsKey(op.Key), []byte(op.Value))
+	default:
+		_, err = c.kv.Update(natsKey(op.Key), []byte(op.Value), revision)
+	}
+	if errors.Is(err, nats.ErrKeyExists) {
+		return &easykv.ConflictError{Key: op.Key}
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't update key: %v %w", op.Key, wrapError(err))
+	}
+	return nil
+}
+
+// revision returns the revision of key, 0 if it doesn't exist.
+func (c *Client) revision(key string) (uint64, error) {
+	entry, err := c.kv.Get(natsKey(key))
+	if errors.Is(err, nats.ErrKeyNotFound) || errors.Is(err, nats.ErrKeyDeleted) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get key: %v %w", key, wrapError(err))
+	}
+	return entry.Revision(), nil
+}
+
+// WatchPrefix watches a specific prefix for changes and returns the revision of the change.
+// WithWaitIndex resumes the watch after the given revision, a key that was changed since is reported at once.
+// If no keys are given, every change below prefix is reported.
+// It returns easykv.ErrWatchCanceled if ctx is done, also if the watcher couldn't be created because of it.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	var (
 		options easykv.WatchOptions
 		watcher nats.KeyWatcher
-		err     error
 	)
 	for _, o := range opts {
 		o(&options)
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	watcher, err = c.kv.Watch(getWatchKey(prefix), nats.Context(ctx), nats.MetaOnly())
 	if err != nil {
-		return 0, fmt.Errorf("couldn't create nats watcher: %w", err)
+		if ctx.Err() != nil {
+			return 0, easykv.ErrWatchCanceled
+		}
+		return 0, fmt.Errorf("couldn't create nats watcher: %w", wrapError(err))
 	}
 
 	defer watcher.Stop()
 
+	var resumed uint64
 	for v := range watcher.Updates() {
 		if v == nil {
 			break
 		}
 		c.revisionMap[v.Key()] = v.Revision()
+		// the initial values hold the latest revision of every key, including the deleted ones
+		if options.WaitIndex > 0 && v.Revision() > max(options.WaitIndex, resumed) && matchKeys(clean(v.Key()), options.Keys) {
+			resumed = v.Revision()
+		}
+	}
+	if resumed > 0 {
+		return resumed, nil
 	}
 
 	for {
@@ -159,15 +471,108 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 				break
 			}
 
-			for _, k := range options.Keys {
-				if strings.HasPrefix(clean(string(v.Key())), k) {
-					if v.Revision() != c.revisionMap[v.Key()] {
-						return v.Revision(), nil
-					}
-				}
+			if matchKeys(clean(v.Key()), options.Keys) && v.Revision() != c.revisionMap[v.Key()] {
+				return v.Revision(), nil
 			}
 		case <-ctx.Done():
 			return 0, easykv.ErrWatchCanceled
 		}
 	}
 }
+
+// Watch streams all changes below prefix.
+// WithWaitIndex replays the retained history after the given revision.
+func (c *Client) Watch(ctx context.Context, prefix string, opts ...easykv.WatchOption) (<-chan easykv.Event, error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	wopts := []nats.WatchOpt{nats.Context(ctx), nats.UpdatesOnly()}
+	if options.WaitIndex > 0 {
+		wopts = []nats.WatchOpt{nats.Context(ctx), nats.IncludeHistory()}
+	}
+
+	watcher, err := c.kv.Watch(getWatchKey(prefix), wopts...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create nats watcher: %w", wrapError(err))
+	}
+
+	events := make(chan easykv.Event)
+	go func() {
+		defer close(events)
+		defer watcher.Stop()
+		for {
+			select {
+			case v, ok := <-watcher.Updates():
+				if !ok {
+					return
+				}
+				// nil marks the end of the initial values
+				if v == nil || v.Revision() <= options.WaitIndex {
+					continue
+				}
+
+				e := easykv.Event{
+					Key:      clean(v.Key()),
+					Value:    string(v.Value()),
+					Type:     easykv.EventPut,
+					Revision: v.Revision(),
+				}
+				if v.Operation() != nats.KeyValuePut {
+					e.Type = easykv.EventDelete
+				}
+				if !matchKeys(e.Key, options.Keys) {
+					continue
+				}
+
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// matchKeys reports whether key starts with one of keys.
+// An empty keys slice matches every key.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports the features of the nats bucket.
+// TTL is only reported if the bucket has a TTL, transactions are limited to a single key.
+func (c *Client) Capabilities() easykv.Capabilities {
+	caps := easykv.Capabilities{Watch: true, Write: true, Transactions: true, Revisions: true, BinaryValues: true}
+	if status, err := c.kv.Status(); err == nil {
+		caps.TTL = status.TTL() > 0
+	}
+	return caps
+}
+
+// Ping checks that the connection is established and flushes it, which waits for a round trip to the server.
+func (c *Client) Ping(ctx context.Context) error {
+	if status := c.nc.Status(); status != nats.CONNECTED {
+		return easykv.WrapError(easykv.ErrUnavailable, fmt.Errorf("nats connection %s", status))
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		// FlushWithContext requires a deadline
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, nats.DefaultTimeout)
+		defer cancel()
+	}
+	return wrapError(c.nc.FlushWithContext(ctx))
+}
@@ -10,10 +10,13 @@ package nats
 
 import (
 	"context"
+	"errors"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
@@ -28,6 +31,16 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+		t.Assert(err, IsNil)
+		return c
+	},
+	SingleKeyTxn: true,
+	NoTTL:        true,
+})
+
 func init() {
 	opts := &server.Options{
 		JetStream: true,
@@ -69,6 +82,16 @@ func init() {
 			panic(err)
 		}
 	}
+
+	_, err = js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket:  "ephemeral",
+		History: 1,
+		Storage: nats.MemoryStorage,
+		TTL:     time.Second,
+	})
+	if err != nil {
+		panic(err)
+	}
 }
 
 func (s *FilterSuite) TestGetValues(t *C) {
@@ -87,6 +110,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	c.kv.PutString("remtest.database.hosts.1.size", "80")
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchEmptyPrefix(t *C) {
@@ -147,3 +171,138 @@ func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestWatch(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	testutils.Watch(t, c)
+}
+
+func (s *FilterSuite) TestOpen(t *C) {
+	c, err := easykv.Open("nats://127.0.0.1:4223/config")
+	t.Assert(err, IsNil)
+	defer c.Close()
+	t.Check(c, FitsTypeOf, &Client{})
+
+	_, err = easykv.Open("nats://127.0.0.1:4223")
+	t.Check(err, NotNil)
+}
+
+func (s *FilterSuite) TestCommit(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	err = c.Commit(ctx, nil, []easykv.TxnOp{easykv.PutOp("/txntest/a", "1"), easykv.PutOp("/txntest/b", "2")})
+	t.Check(err, Equals, ErrMultiKeyTxn)
+	err = c.Commit(ctx, []easykv.Compare{{Key: "/txntest/a"}}, []easykv.TxnOp{easykv.PutOp("/txntest/b", "2")})
+	t.Check(err, Equals, ErrMultiKeyTxn)
+
+	t.Assert(c.Commit(ctx, []easykv.Compare{{Key: "/txntest/a"}}, []easykv.TxnOp{easykv.PutOp("/txntest/a", "1")}), IsNil)
+	rev, err := c.revision("/txntest/a")
+	t.Assert(err, IsNil)
+
+	err = c.Commit(ctx, []easykv.Compare{{Key: "/txntest/a", Revision: rev + 1}}, []easykv.TxnOp{easykv.DeleteOp("/txntest/a")})
+	t.Check(errors.Is(err, easykv.ErrConflict), Equals, true)
+	t.Assert(c.Commit(ctx, []easykv.Compare{{Key: "/txntest/a", Revision: rev}}, []easykv.TxnOp{easykv.DeleteOp("/txntest/a")}), IsNil)
+
+	// a deleted key can be created again
+	t.Check(c.Commit(ctx, []easykv.Compare{{Key: "/txntest/a"}}, nil), IsNil)
+	t.Check(c.CompareAndSwap(ctx, "/txntest/a", 0, "2"), IsNil)
+	t.Check(c.Delete(ctx, "/txntest/a"), IsNil)
+}
+
+func (s *FilterSuite) TestGetSnapshotBusy(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	t.Assert(err, IsNil)
+	defer c.Close()
+	ctx := context.Background()
+	t.Assert(c.Set(ctx, "/snapshottest/a", "1"), IsNil)
+	defer c.DeletePrefix(ctx, "/snapshottest")
+
+	// steady writes change the bucket during every read
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c.Set(ctx, "/snapshottest/busy", strconv.Itoa(i))
+		}
+	}()
+
+	start := time.Now()
+	_, err = c.GetSnapshot(ctx, []string{"/snapshottest"})
+	close(stop)
+	<-done
+	t.Check(errors.Is(err, easykv.ErrConflict), Equals, true, Commentf("%v", err))
+	t.Check(time.Since(start) < 5*time.Second, Equals, true)
+
+	// a quiet bucket can be read again
+	snap, err := c.GetSnapshot(ctx, []string{"/snapshottest/a"})
+	t.Assert(err, IsNil)
+	t.Check(snap.Values, DeepEquals, map[string]string{"/snapshottest/a": "1"})
+}
+
+func (s *FilterSuite) TestSetWithTTL(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	t.Assert(err, IsNil)
+	_, err = c.SetWithTTL(context.Background(), "/instances/a", "up", time.Second)
+	t.Check(err, Equals, ErrNoBucketTTL)
+	c.Close()
+
+	c, err = New([]string{"nats://127.0.0.1:4223"}, "ephemeral")
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	lease, err := c.SetWithTTL(context.Background(), "/instances/a", "up", time.Second)
+	t.Assert(err, IsNil)
+
+	// the key outlives the ttl of the bucket while the lease is kept alive
+	time.Sleep(1500 * time.Millisecond)
+	m, err := c.GetValues([]string{"/instances"})
+	t.Assert(err, IsNil)
+	t.Check(m, DeepEquals, map[string]string{"/instances/a": "up"})
+
+	t.Assert(lease.Close(), IsNil)
+	<-lease.Done()
+	_, err = c.GetValues([]string{"/instances"})
+	t.Check(errors.Is(err, easykv.ErrKeyNotFound), Equals, true)
+}
+
+func (s *FilterSuite) TestWriteCanceled(t *C) {
+	c, err := New([]string{"nats://127.0.0.1:4223"}, "config")
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	t.Check(errors.Is(c.Set(ctx, "/canceltest/a", "1"), context.Canceled), Equals, true)
+	t.Check(errors.Is(c.Delete(ctx, "/canceltest/a"), context.Canceled), Equals, true)
+	t.Check(errors.Is(c.DeletePrefix(ctx, "/canceltest"), context.Canceled), Equals, true)
+
+	m, err := c.GetValues([]string{"/canceltest"})
+	t.Assert(err, IsNil)
+	t.Check(m, HasLen, 0)
+}
@@ -0,0 +1,44 @@
+/*
+ * This file is part of easyKV.
+ * © 2022 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package nats
+
+import (
+	"errors"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/nats-io/nats.go"
+)
+
+// ErrMultiKeyTxn is returned by Commit if the transaction touches more than one key,
+// nats KV can only update a single key conditionally.
+var ErrMultiKeyTxn = errors.New("nats kv can't change several keys in one transaction")
+
+// ErrNoBucketTTL is returned by SetWithTTL if the bucket has no TTL.
+var ErrNoBucketTTL = errors.New("nats kv bucket has no ttl")
+
+// wrapError marks the errors of the nats client with the easykv error kinds.
+func wrapError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, nats.ErrKeyNotFound), errors.Is(err, nats.ErrKeyDeleted),
+		errors.Is(err, nats.ErrNoKeysFound), errors.Is(err, nats.ErrBucketNotFound):
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case errors.Is(err, nats.ErrAuthorization), errors.Is(err, nats.ErrAuthExpired),
+		errors.Is(err, nats.ErrAuthRevoked), errors.Is(err, nats.ErrPermissionViolation):
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	case errors.Is(err, nats.ErrNoServers), errors.Is(err, nats.ErrConnectionClosed),
+		errors.Is(err, nats.ErrConnectionReconnecting), errors.Is(err, nats.ErrDisconnected),
+		errors.Is(err, nats.ErrNoResponders):
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	case errors.Is(err, nats.ErrTimeout):
+		return easykv.WrapError(easykv.ErrTimeout, err)
+	}
+	return easykv.ClassifyError(err)
+}
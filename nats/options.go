@@ -8,12 +8,15 @@
 
 package nats
 
+import "log/slog"
+
 // Options contains all values that are needed to connect to nats.
 type Options struct {
-	Nodes []string
-	Auth  BasicAuthOptions
-	Token string
-	Creds string
+	Nodes  []string
+	Auth   BasicAuthOptions
+	Token  string
+	Creds  string
+	Logger *slog.Logger
 }
 
 // BasicAuthOptions contains options regarding to basic authentication.
@@ -45,3 +48,10 @@ func WithToken(t string) Option {
 		o.Token = t
 	}
 }
+
+// WithLogger sets the logger for connection changes and watches, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
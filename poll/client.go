@@ -0,0 +1,188 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+// Package poll adds WatchPrefix to backends without watch support by polling GetValues.
+package poll
+
+import (
+	"context"
+	"crypto/sha256"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+// DefaultInterval is the default poll interval.
+const DefaultInterval = 10 * time.Second
+
+// Client implements WatchPrefix by periodically calling GetValues.
+type Client struct {
+	rw       easykv.ReadWatcher
+	interval time.Duration
+
+	mu     sync.Mutex
+	index  uint64
+	states map[string]state // watched prefix and keys -> last seen content
+}
+
+type state struct {
+	hash  [sha256.Size]byte
+	index uint64
+}
+
+// New returns a polling *poll.Client for rw.
+func New(rw easykv.ReadWatcher, opts ...Option) *Client {
+	c := &Client{
+		rw:       rw,
+		interval: DefaultInterval,
+		states:   make(map[string]state),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// GetValues calls GetValues of the underlying backend.
+func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.rw.GetValues(keys)
+}
+
+// GetValuesContext calls GetValuesContext of the underlying backend.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	return easykv.GetValuesContext(ctx, c.rw, keys)
+}
+
+// Close closes the underlying backend.
+func (c *Client) Close() {
+	c.rw.Close()
+}
+
+// WatchPrefix polls the values below prefix until the values matching WithKeys change.
+// If no keys are given, every value below prefix is compared.
+//
+// The returned index increases with every change seen by this client.
+// A WaitIndex returned earlier is compared with the values seen at that index,
+// so changes between two calls aren't lost. WaitIndex 0 waits for the next change.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	id := prefix + "\x00" + strings.Join(options.Keys, "\x00")
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	hash, err := c.hash(ctx, prefix, options.Keys)
+	if err != nil {
+		return options.WaitIndex, err
+	}
+
+	seen := options.WaitIndex
+	c.mu.Lock()
+	if last, ok := c.states[id]; !ok || seen == 0 || seen > last.index {
+		// the caller has nothing to compare with, wait for the next change
+		seen = c.record(id, hash)
+	}
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		index := c.record(id, hash)
+		c.mu.Unlock()
+		if index != seen {
+			return index, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return options.WaitIndex, easykv.ErrWatchCanceled
+		case <-ticker.C:
+		}
+
+		hash, err = c.hash(ctx, prefix, options.Keys)
+		if err != nil {
+			if ctx.Err() != nil {
+				return options.WaitIndex, easykv.ErrWatchCanceled
+			}
+			return options.WaitIndex, err
+		}
+	}
+}
+
+// record stores hash as the current content of id and returns the index of the content.
+// c.mu must be held.
+func (c *Client) record(id string, hash [sha256.Size]byte) uint64 {
+	current, ok := c.states[id]
+	if !ok || hash != current.hash {
+		c.index++
+		current = state{hash: hash, index: c.index}
+		c.states[id] = current
+	}
+	return current.index
+}
+
+// hash returns the hash of the sorted values below prefix matching keys.
+func (c *Client) hash(ctx context.Context, prefix string, keys []string) ([sha256.Size]byte, error) {
+	values, err := easykv.GetValuesContext(ctx, c.rw, []string{prefix})
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	names := make([]string, 0, len(values))
+	for k := range values {
+		if matchKeys(k, keys) {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, k := range names {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(values[k]))
+		h.Write([]byte{0})
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
+
+// matchKeys reports whether key starts with one of keys.
+// An empty keys slice matches every key.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports a watch, which is the point of polling,
+// and the binary value support of the underlying backend.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, BinaryValues: easykv.CapabilitiesOf(c.rw).BinaryValues}
+}
+
+// Ping pings the underlying backend if it implements easykv.Pinger.
+func (c *Client) Ping(ctx context.Context) error {
+	if p, ok := c.rw.(easykv.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package poll
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/HeavyHorst/easykv/memkv"
+	"github.com/HeavyHorst/easykv/testutils"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := memkv.New(nil)
+		t.Assert(err, IsNil)
+		return pollWriter{New(c, WithInterval(10*time.Millisecond)), c}
+	},
+})
+
+// pollWriter lets the conformance suite write to the polled backend.
+type pollWriter struct {
+	*Client
+	easykv.Writer
+}
+
+// backend is a map without watch support.
+type backend struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (b *backend) GetValues(keys []string) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	vars := make(map[string]string)
+	for k, v := range b.values {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+func (b *backend) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+	return 0, easykv.ErrWatchNotSupported
+}
+
+func (b *backend) Close() {}
+
+func (b *backend) set(key, value string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[key] = value
+}
+
+func (s *FilterSuite) TestWatchPrefix(t *C) {
+	b := &backend{values: map[string]string{"/app/port": "80", "/app/host": "localhost"}}
+	c := New(b, WithInterval(10*time.Millisecond))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.set("/app/port", "8080")
+	}()
+	index, err := c.WatchPrefix(context.Background(), "/app", easykv.WithKeys([]string{"/app/port"}))
+	t.Assert(err, IsNil)
+	t.Check(index > 0, Equals, true)
+
+	// a change between two calls is reported at once
+	b.set("/app/port", "8081")
+	next, err := c.WatchPrefix(context.Background(), "/app", easykv.WithKeys([]string{"/app/port"}), easykv.WithWaitIndex(index))
+	t.Assert(err, IsNil)
+	t.Check(next > index, Equals, true)
+
+	// changes of other keys are ignored
+	b.set("/app/host", "example.com")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	last, err := c.WatchPrefix(ctx, "/app", easykv.WithKeys([]string{"/app/port"}), easykv.WithWaitIndex(next))
+	t.Check(err, Equals, easykv.ErrWatchCanceled)
+	t.Check(last, Equals, next)
+}
+
+func (s *FilterSuite) TestInterval(t *C) {
+	b := &backend{values: map[string]string{"/app/port": "80"}}
+	for _, interval := range []time.Duration{0, -time.Second} {
+		c := New(b, WithInterval(interval))
+		t.Check(c.interval, Equals, DefaultInterval)
+
+		// WatchPrefix doesn't panic
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := c.WatchPrefix(ctx, "/app")
+		cancel()
+		t.Check(err, Equals, easykv.ErrWatchCanceled)
+	}
+}
+
+func (s *FilterSuite) TestWatchPrefixAllKeys(t *C) {
+	b := &backend{values: map[string]string{"/app/port": "80"}}
+	c := New(b, WithInterval(10*time.Millisecond))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.set("/app/host", "localhost")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := c.WatchPrefix(ctx, "/app")
+	t.Check(err, IsNil)
+}
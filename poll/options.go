@@ -0,0 +1,24 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package poll
+
+import "time"
+
+// Option configures the poll client.
+type Option func(*Client)
+
+// WithInterval sets how often WatchPrefix polls the backend (default: 10 seconds).
+// An interval that isn't positive keeps the default.
+func WithInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		if interval > 0 {
+			c.interval = interval
+		}
+	}
+}
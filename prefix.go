@@ -0,0 +1,315 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/HeavyHorst/easykv/lock"
+)
+
+type prefixed struct {
+	rw     ReadWatcher
+	prefix string
+}
+
+// Prefixed returns a ReadWatcher that reads and writes the keys of rw below prefix,
+// e.g. the key /port is /app/port in rw for the prefix /app.
+// The prefix is stripped from the returned keys. It is used by Open for the path of the backend url.
+//
+// The returned ReadWatcher implements Writer, EventWatcher, EntryReader, SnapshotReader, Txn, TTLWriter,
+// lock.Locker and lock.Elector with the prefix applied. If rw doesn't implement one of them, its methods fail
+// with ErrNotSupported (ErrWriteNotSupported and ErrWatchNotSupported for Writer and EventWatcher),
+// Capabilities reports the features of rw.
+func Prefixed(rw ReadWatcher, prefix string) ReadWatcher {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return rw
+	}
+	return &prefixed{rw: rw, prefix: prefix}
+}
+
+// key returns the key of rw for k. A trailing slash of k is kept.
+func (p *prefixed) key(k string) string {
+	k = strings.TrimPrefix(k, "/")
+	if k == "" {
+		return p.prefix
+	}
+	return p.prefix + "/" + k
+}
+
+// keys returns the keys of rw for keys.
+func (p *prefixed) keys(keys []string) []string {
+	if keys == nil {
+		return nil
+	}
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = p.key(k)
+	}
+	return full
+}
+
+// strip returns the key of p for the key k of rw and false if k isn't below the prefix.
+func (p *prefixed) strip(k string) (string, bool) {
+	switch {
+	case k == p.prefix:
+		return "/", true
+	case strings.HasPrefix(k, p.prefix+"/"):
+		return k[len(p.prefix):], true
+	}
+	return "", false
+}
+
+// stripValues returns the values of rw below the prefix with stripped keys.
+func (p *prefixed) stripValues(values map[string]string) map[string]string {
+	vars := make(map[string]string, len(values))
+	for k, v := range values {
+		if k, ok := p.strip(k); ok {
+			vars[k] = v
+		}
+	}
+	return vars
+}
+
+// stripConflict strips the prefix from the key of a *ConflictError.
+func (p *prefixed) stripConflict(err error) error {
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		if k, ok := p.strip(conflict.Key); ok {
+			return &ConflictError{Key: k}
+		}
+	}
+	return err
+}
+
+// GetValues is used to lookup all keys with a prefix below the prefix of p.
+func (p *prefixed) GetValues(keys []string) (map[string]string, error) {
+	return p.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests are bound to ctx.
+func (p *prefixed) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	values, err := GetValuesContext(ctx, p.rw, p.keys(keys))
+	return p.stripValues(values), err
+}
+
+// WatchPrefix watches prefix below the prefix of p.
+func (p *prefixed) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (uint64, error) {
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	return p.rw.WatchPrefix(ctx, p.key(prefix), WithWaitIndex(options.WaitIndex), WithKeys(p.keys(options.Keys)))
+}
+
+// Watch streams the changes below prefix if rw is an EventWatcher.
+func (p *prefixed) Watch(ctx context.Context, prefix string, opts ...WatchOption) (<-chan Event, error) {
+	ew, ok := p.rw.(EventWatcher)
+	if !ok {
+		return nil, ErrWatchNotSupported
+	}
+	var options WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+	events, err := ew.Watch(ctx, p.key(prefix), WithWaitIndex(options.WaitIndex), WithKeys(p.keys(options.Keys)))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Event)
+	go func() {
+		defer close(out)
+		for ev := range events {
+			if ev.Err == nil {
+				k, ok := p.strip(ev.Key)
+				if !ok {
+					continue
+				}
+				ev.Key = k
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// GetEntries returns the entries below the prefix of p if rw is an EntryReader.
+func (p *prefixed) GetEntries(ctx context.Context, keys []string) ([]Entry, error) {
+	er, ok := p.rw.(EntryReader)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	entries, err := er.GetEntries(ctx, p.keys(keys))
+	if err != nil {
+		return nil, err
+	}
+	stripped := entries[:0]
+	for _, e := range entries {
+		if k, ok := p.strip(e.Key); ok {
+			e.Key = k
+			stripped = append(stripped, e)
+		}
+	}
+	return stripped, nil
+}
+
+// GetSnapshot returns the values below the prefix of p at a single revision if rw is a SnapshotReader.
+func (p *prefixed) GetSnapshot(ctx context.Context, keys []string) (Snapshot, error) {
+	sr, ok := p.rw.(SnapshotReader)
+	if !ok {
+		return Snapshot{}, ErrNotSupported
+	}
+	snap, err := sr.GetSnapshot(ctx, p.keys(keys))
+	if err != nil {
+		return Snapshot{}, err
+	}
+	snap.Values = p.stripValues(snap.Values)
+	return snap, nil
+}
+
+// Set sets the value of key if rw is a Writer.
+func (p *prefixed) Set(ctx context.Context, key, value string) error {
+	w, ok := p.rw.(Writer)
+	if !ok {
+		return ErrWriteNotSupported
+	}
+	return w.Set(ctx, p.key(key), value)
+}
+
+// Delete removes key if rw is a Writer.
+func (p *prefixed) Delete(ctx context.Context, key string) error {
+	w, ok := p.rw.(Writer)
+	if !ok {
+		return ErrWriteNotSupported
+	}
+	return w.Delete(ctx, p.key(key))
+}
+
+// DeletePrefix removes all keys with the given prefix if rw is a Writer.
+func (p *prefixed) DeletePrefix(ctx context.Context, prefix string) error {
+	w, ok := p.rw.(Writer)
+	if !ok {
+		return ErrWriteNotSupported
+	}
+	return w.DeletePrefix(ctx, p.key(prefix))
+}
+
+// SetWithTTL sets the value of key with a ttl if rw is a TTLWriter.
+func (p *prefixed) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (Lease, error) {
+	tw, ok := p.rw.(TTLWriter)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return tw.SetWithTTL(ctx, p.key(key), value, ttl)
+}
+
+// CompareAndSwap sets the value of key if it is still at revision and rw is a Txn.
+func (p *prefixed) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	txn, ok := p.rw.(Txn)
+	if !ok {
+		return ErrNotSupported
+	}
+	return p.stripConflict(txn.CompareAndSwap(ctx, p.key(key), revision, value))
+}
+
+// Commit applies ops if all cmps hold and rw is a Txn.
+func (p *prefixed) Commit(ctx context.Context, cmps []Compare, ops []TxnOp) error {
+	txn, ok := p.rw.(Txn)
+	if !ok {
+		return ErrNotSupported
+	}
+	full := make([]Compare, len(cmps))
+	for i, cmp := range cmps {
+		full[i] = Compare{Key: p.key(cmp.Key), Revision: cmp.Revision}
+	}
+	fullOps := make([]TxnOp, len(ops))
+	for i, op := range ops {
+		op.Key = p.key(op.Key)
+		fullOps[i] = op
+	}
+	return p.stripConflict(txn.Commit(ctx, full, fullOps))
+}
+
+// Lock acquires the lock key if rw is a lock.Locker.
+func (p *prefixed) Lock(ctx context.Context, key string) (lock.Lock, error) {
+	l, ok := p.rw.(lock.Locker)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	return l.Lock(ctx, p.key(key))
+}
+
+// Election returns a candidate for the election key if rw is a lock.Elector.
+// Otherwise Campaign and Resign of the candidate fail with ErrNotSupported.
+func (p *prefixed) Election(key string) lock.Election {
+	e, ok := p.rw.(lock.Elector)
+	if !ok {
+		return unsupportedElection{}
+	}
+	return e.Election(p.key(key))
+}
+
+// Close closes rw.
+func (p *prefixed) Close() {
+	p.rw.Close()
+}
+
+// Capabilities reports the features of rw.
+func (p *prefixed) Capabilities() Capabilities {
+	caps := CapabilitiesOf(p.rw)
+	_, write := p.rw.(Writer)
+	_, ttl := p.rw.(TTLWriter)
+	_, txn := p.rw.(Txn)
+	_, revisions := p.rw.(EntryReader)
+	caps.Write = caps.Write && write
+	caps.TTL = caps.TTL && ttl
+	caps.Transactions = caps.Transactions && txn
+	caps.Revisions = caps.Revisions && revisions
+	return caps
+}
+
+// Ping pings rw if it implements Pinger.
+func (p *prefixed) Ping(ctx context.Context) error {
+	if pinger, ok := p.rw.(Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+// unsupportedElection is the lock.Election of a backend without elections.
+type unsupportedElection struct{}
+
+func (unsupportedElection) Campaign(ctx context.Context, value string) error {
+	return ErrNotSupported
+}
+
+func (unsupportedElection) Resign(ctx context.Context) error {
+	return ErrNotSupported
+}
+
+func (unsupportedElection) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (unsupportedElection) Observe(ctx context.Context) <-chan string {
+	values := make(chan string)
+	close(values)
+	return values
+}
@@ -0,0 +1,199 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+)
+
+// store is a ReadWatcher and Writer on a map that records the arguments of its calls.
+type store struct {
+	values map[string]string
+	keys   []string
+	prefix string
+	opts   WatchOptions
+}
+
+func (s *store) GetValues(keys []string) (map[string]string, error) {
+	s.keys = keys
+	vars := make(map[string]string)
+	for k, v := range s.values {
+		for _, key := range keys {
+			if strings.HasPrefix(k, key) {
+				vars[k] = v
+			}
+		}
+	}
+	return vars, nil
+}
+
+func (s *store) WatchPrefix(ctx context.Context, prefix string, opts ...WatchOption) (uint64, error) {
+	s.prefix = prefix
+	for _, o := range opts {
+		o(&s.opts)
+	}
+	return s.opts.WaitIndex + 1, nil
+}
+
+func (s *store) Set(ctx context.Context, key, value string) error {
+	s.values[key] = value
+	return nil
+}
+
+func (s *store) Delete(ctx context.Context, key string) error {
+	delete(s.values, key)
+	return nil
+}
+
+func (s *store) DeletePrefix(ctx context.Context, prefix string) error {
+	for k := range s.values {
+		if strings.HasPrefix(k, prefix) {
+			delete(s.values, k)
+		}
+	}
+	return nil
+}
+
+func (s *store) Close() {}
+
+func (s *store) GetEntries(ctx context.Context, keys []string) ([]Entry, error) {
+	s.keys = keys
+	var entries []Entry
+	for k, v := range s.values {
+		for _, key := range keys {
+			if strings.HasPrefix(k, key) {
+				entries = append(entries, Entry{Key: k, Value: []byte(v)})
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+func (s *store) Watch(ctx context.Context, prefix string, opts ...WatchOption) (<-chan Event, error) {
+	s.prefix = prefix
+	events := make(chan Event, 2)
+	events <- Event{Key: "/application", Value: "other", Type: EventPut}
+	events <- Event{Key: "/app/port", Value: "81", Type: EventPut}
+	close(events)
+	return events, nil
+}
+
+func (s *store) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return &ConflictError{Key: key}
+}
+
+func (s *store) Commit(ctx context.Context, cmps []Compare, ops []TxnOp) error {
+	for _, op := range ops {
+		s.values[op.Key] = op.Value
+	}
+	return nil
+}
+
+func (s *FilterSuite) TestPrefixed(t *C) {
+	backend := &store{values: map[string]string{
+		"/app":          "root",
+		"/app/port":     "80",
+		"/app/db/url":   "www.google.de",
+		"/application":  "other",
+		"/other/secret": "x",
+	}}
+	rw := Prefixed(backend, "/app/")
+
+	vals, err := rw.GetValues([]string{"/"})
+	t.Assert(err, IsNil)
+	t.Check(backend.keys, DeepEquals, []string{"/app"})
+	// /application matches the prefix of the backend, but isn't below /app
+	t.Check(vals, DeepEquals, map[string]string{"/": "root", "/port": "80", "/db/url": "www.google.de"})
+
+	vals, err = rw.GetValues([]string{"/db"})
+	t.Assert(err, IsNil)
+	t.Check(vals, DeepEquals, map[string]string{"/db/url": "www.google.de"})
+
+	index, err := rw.WatchPrefix(context.Background(), "/db", WithKeys([]string{"/db/url"}), WithWaitIndex(4))
+	t.Assert(err, IsNil)
+	t.Check(index, Equals, uint64(5))
+	t.Check(backend.prefix, Equals, "/app/db")
+	t.Check(backend.opts.Keys, DeepEquals, []string{"/app/db/url"})
+
+	w := rw.(Writer)
+	t.Assert(w.Set(context.Background(), "/db/user", "Boris"), IsNil)
+	t.Check(backend.values["/app/db/user"], Equals, "Boris")
+	t.Assert(w.DeletePrefix(context.Background(), "/db"), IsNil)
+	t.Check(backend.values, DeepEquals, map[string]string{
+		"/app":          "root",
+		"/app/port":     "80",
+		"/application":  "other",
+		"/other/secret": "x",
+	})
+
+	// an empty prefix returns rw itself
+	t.Check(Prefixed(backend, "/"), Equals, ReadWatcher(backend))
+}
+
+func (s *FilterSuite) TestPrefixedOptional(t *C) {
+	backend := &store{values: map[string]string{
+		"/app/port":    "80",
+		"/app/dir/a":   "1",
+		"/app/dirs":    "x",
+		"/application": "other",
+	}}
+	rw := Prefixed(backend, "/app")
+
+	// a trailing slash of the caller is kept
+	vals, err := rw.GetValues([]string{"/dir/"})
+	t.Assert(err, IsNil)
+	t.Check(backend.keys, DeepEquals, []string{"/app/dir/"})
+	t.Check(vals, DeepEquals, map[string]string{"/dir/a": "1"})
+
+	entries, err := rw.(EntryReader).GetEntries(context.Background(), []string{"/"})
+	t.Assert(err, IsNil)
+	t.Check(entries, DeepEquals, []Entry{
+		{Key: "/dir/a", Value: []byte("1")},
+		{Key: "/dirs", Value: []byte("x")},
+		{Key: "/port", Value: []byte("80")},
+	})
+
+	events, err := rw.(EventWatcher).Watch(context.Background(), "/")
+	t.Assert(err, IsNil)
+	t.Check(backend.prefix, Equals, "/app")
+	var got []Event
+	for ev := range events {
+		got = append(got, ev)
+	}
+	t.Check(got, DeepEquals, []Event{{Key: "/port", Value: "81", Type: EventPut}})
+
+	txn := rw.(Txn)
+	err = txn.CompareAndSwap(context.Background(), "/port", 1, "82")
+	t.Check(err, DeepEquals, error(&ConflictError{Key: "/port"}))
+	t.Assert(txn.Commit(context.Background(), nil, []TxnOp{PutOp("/user", "Boris")}), IsNil)
+	t.Check(backend.values["/app/user"], Equals, "Boris")
+
+	caps := CapabilitiesOf(rw)
+	t.Check(caps.Transactions, Equals, true)
+	t.Check(caps.Revisions, Equals, true)
+	t.Check(caps.TTL, Equals, false)
+
+	// the optional features rw doesn't implement fail
+	_, err = rw.(TTLWriter).SetWithTTL(context.Background(), "/port", "80", time.Second)
+	t.Check(err, Equals, ErrNotSupported)
+
+	plain := Prefixed(struct{ ReadWatcher }{backend}, "/app")
+	_, err = plain.(SnapshotReader).GetSnapshot(context.Background(), []string{"/"})
+	t.Check(errors.Is(err, ErrNotSupported), Equals, true)
+	_, err = plain.(EventWatcher).Watch(context.Background(), "/")
+	t.Check(err, Equals, ErrWatchNotSupported)
+	t.Check(CapabilitiesOf(plain), Equals, Capabilities{Watch: true})
+}
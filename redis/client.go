@@ -18,7 +18,12 @@ package redis
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
+	"log/slog"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,18 +31,53 @@ import (
 	"github.com/garyburd/redigo/redis"
 )
 
-// Client is a wrapper around the redis client
+// Client is a wrapper around pools of redis connections.
+// It is safe for concurrent use.
 type Client struct {
-	client   redis.Conn
+	topo     topology
 	machines []string
 	password string
 	db       int
+	logger   *slog.Logger
+
+	maxIdle     int
+	maxActive   int
+	idleTimeout time.Duration
+
+	sentinelMaster string
+	cluster        bool
+
+	types     []string // the value types that are flattened
+	scanCount int
+
+	notifyConfig bool
+	watchIndex   uint64 // accessed atomically
 }
 
+// The redis value types, TypeString is always read.
+const (
+	TypeString = "string"
+	TypeHash   = "hash"
+	TypeList   = "list"
+	TypeSet    = "set"
+)
+
+// DefaultMaxIdle is the default number of idle connections kept in the pool.
+const DefaultMaxIdle = 3
+
+// DefaultScanCount is the default COUNT hint of the SCAN commands.
+const DefaultScanCount = 1000
+
+// DefaultIdleTimeout is the default time after which idle connections are closed.
+const DefaultIdleTimeout = 4 * time.Minute
+
+// connections that were idle for longer are tested with a PING before they are used
+const testOnBorrowAfter = time.Second
+
 // Iterate through `machines`, trying to connect to each in turn.
 // Returns the first successful connection or the last error encountered.
 // Assumes that `machines` is non-empty.
-func tryConnect(machines []string, db int, password string) (redis.Conn, error) {
+func tryConnect(machines []string, db int, password string, logger *slog.Logger) (redis.Conn, error) {
 	var err error
 	for _, address := range machines {
 		var conn redis.Conn
@@ -60,78 +100,167 @@ func tryConnect(machines []string, db int, password string) (redis.Conn, error)
 		conn, err = redis.Dial(network, address, dialops...)
 
 		if err != nil {
+			logger.Warn("connect failed", "address", address, "error", err)
 			continue
 		}
+		logger.Debug("connected", "address", address)
 		return conn, nil
 	}
-	return nil, err
+	return nil, wrapError(err)
 }
 
-// Retrieves a connected redis client from the client wrapper.
-// Existing connections will be tested with a PING command before being returned. Tries to reconnect once if necessary.
-// Returns the established redis connection or the error encountered.
-func (c *Client) connectedClient() (redis.Conn, error) {
-	if c.client != nil {
-		resp, err := c.client.Do("PING")
-		if (err != nil && err == redis.ErrNil) || resp != "PONG" {
-			c.client = nil
-		}
+// conn returns a pooled connection to the server of key, it has to be closed after use.
+// Connections are dialed again if they were lost, so a standalone client fails over to the
+// next reachable machine and a sentinel client to the current master.
+func (c *Client) conn(ctx context.Context, key string) (redis.Conn, error) {
+	conn, err := c.topo.conn(ctx, key)
+	if err != nil {
+		return nil, wrapError(err)
 	}
+	return conn, nil
+}
 
-	// Existing client could have been deleted by previous block
-	if c.client == nil {
-		var err error
-		c.client, err = tryConnect(c.machines, c.db, c.password)
-		if err != nil {
-			return nil, err
-		}
+// newPool returns a pool with the settings of the client.
+// Idle connections are checked with test before they are used.
+func (c *Client) newPool(dial func() (redis.Conn, error), test func(conn redis.Conn) error) *redis.Pool {
+	return &redis.Pool{
+		Dial: dial,
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			if time.Since(t) < testOnBorrowAfter {
+				return nil
+			}
+			err := test(conn)
+			if err != nil {
+				c.logger.Info("connection lost, reconnecting", "error", err)
+			}
+			return err
+		},
+		MaxIdle:     c.maxIdle,
+		MaxActive:   c.maxActive,
+		IdleTimeout: c.idleTimeout,
+		Wait:        c.maxActive > 0,
 	}
+}
 
-	return c.client, nil
+func ping(conn redis.Conn) error {
+	_, err := conn.Do("PING")
+	return err
 }
 
-// New returns an *redis.Client with a connection to named machines.
+// New returns an *redis.Client with a pool of connections to named machines.
 // It returns an error if a connection to the cluster cannot be made.
+//
+// By default the machines are tried in order. With WithSentinel they are the addresses of the sentinels
+// that are asked for the master, with WithCluster they are the seed nodes of a redis cluster.
 func New(machines []string, opts ...Option) (*Client, error) {
-	var err error
-	var c Client
+	c := Client{
+		maxIdle:     DefaultMaxIdle,
+		idleTimeout: DefaultIdleTimeout,
+		types:       []string{TypeHash, TypeList, TypeSet},
+		scanCount:   DefaultScanCount,
+	}
 	for _, o := range opts {
 		o(&c)
 	}
 	c.machines = machines
+	c.logger = easykv.BackendLogger(c.logger, "redis")
+
+	switch {
+	case c.cluster:
+		cl := &cluster{
+			seeds: machines,
+			dial: func(address string) (redis.Conn, error) {
+				return tryConnect([]string{address}, 0, c.password, c.logger)
+			},
+			newPool: func(dial func() (redis.Conn, error)) *redis.Pool { return c.newPool(dial, ping) },
+			logger:  c.logger,
+			slots:   make([]string, clusterSlots),
+			pools:   make(map[string]*redis.Pool),
+		}
+		c.topo = cl
+		return &c, wrapError(cl.refresh())
+	case c.sentinelMaster != "":
+		dial := func() (redis.Conn, error) {
+			return resolveMaster(c.machines, c.sentinelMaster, c.db, c.password, c.logger)
+		}
+		// a failover turns the master into a replica
+		c.topo = &single{pool: c.newPool(dial, checkMaster), dial: dial}
+	default:
+		dial := func() (redis.Conn, error) {
+			return tryConnect(c.machines, c.db, c.password, c.logger)
+		}
+		c.topo = &single{pool: c.newPool(dial, ping), dial: dial}
+	}
 
-	c.client, err = tryConnect(c.machines, c.db, c.password)
-	return &c, err
+	// dial the first connection, it is kept in the pool
+	conn, err := c.topo.conn(context.Background(), "")
+	if err != nil {
+		return &c, wrapError(err)
+	}
+	return &c, conn.Close()
 }
 
-// Close closes the redis client connection.
+// Close closes the pools and all their idle connections.
 func (c *Client) Close() {
-	if c.client != nil {
-		c.client.Close()
+	c.topo.close()
+}
+
+// scan calls fn with every page of the keys that match pattern on every master.
+// fn gets the connection to the master that stores the keys.
+func (c *Client) scan(ctx context.Context, pattern string, fn func(conn redis.Conn, keys []string) error) error {
+	conns, err := c.topo.masters(ctx)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer closeAll(conns)
+
+	for _, conn := range conns {
+		idx := 0
+		for {
+			values, err := redis.Values(do(ctx, conn, "SCAN", idx, "MATCH", pattern, "COUNT", c.scanCount))
+			if err != nil {
+				return wrapError(err)
+			}
+			idx, _ = redis.Int(values[0], nil)
+			items, _ := redis.Strings(values[1], nil)
+			if len(items) > 0 {
+				if err := fn(conn, items); err != nil {
+					return err
+				}
+			}
+			if idx == 0 {
+				break
+			}
+		}
 	}
+	return nil
 }
 
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
-// The redis SCAN operation is, for performance reasons, limited to 1000 results.
+// The keys are read in pages of SCAN operations, see WithScanCount.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
-	// Ensure we have a connected redis client
-	rClient, err := c.connectedClient()
-	if err != nil && err != redis.ErrNil {
-		return nil, err
-	}
+	return c.GetValuesContext(context.Background(), keys)
+}
 
+// GetValuesContext is like GetValues but the commands are bound to ctx.
+// The deadline of ctx is used as the read and write timeout of every command.
+// Hashes, lists and sets are flattened into nested keys, see WithTypes.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
+	return c.getValues(ctx, keys, nil)
+}
+
+// getValues is GetValuesContext, the ttls of the values are added to ttls if it isn't nil.
+func (c *Client) getValues(ctx context.Context, keys []string, ttls map[string]time.Duration) (map[string]string, error) {
 	vars := make(map[string]string)
 	for _, key := range keys {
 		key = strings.Replace(key, "/*", "", -1)
-		value, err := redis.String(rClient.Do("GET", key))
-		if err == nil {
-			vars[key] = value
-			continue
+		found, err := c.readKey(ctx, key, vars, ttls)
+		if err != nil {
+			return vars, wrapError(err)
 		}
-
-		if err != redis.ErrNil {
-			return vars, err
+		if found {
+			continue
 		}
 
 		if key == "/" {
@@ -140,32 +269,538 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 			key = fmt.Sprintf("%s/*", key)
 		}
 
-		idx := 0
-		for {
-			values, err := redis.Values(rClient.Do("SCAN", idx, "MATCH", key, "COUNT", "1000"))
-			if err != nil && err != redis.ErrNil {
-				return vars, err
+		err = c.scan(ctx, key, func(conn redis.Conn, items []string) error {
+			return wrapError(c.readPage(ctx, conn, items, vars, ttls))
+		})
+		if err != nil {
+			return vars, err
+		}
+	}
+	return vars, nil
+}
+
+// readKey is like read on a connection to the server of key.
+func (c *Client) readKey(ctx context.Context, key string, vars map[string]string, ttls map[string]time.Duration) (bool, error) {
+	rClient, err := c.conn(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	defer rClient.Close()
+	return c.read(ctx, rClient, key, vars, ttls)
+}
+
+// read adds the value of key to vars. Hashes are flattened to key/field, lists to key/index
+// and the sorted members of sets to key/index, like the nested values of the file backend.
+// The ttl of key is added to ttls for all of them if ttls isn't nil.
+// It reports false if key doesn't exist or its type isn't expanded.
+func (c *Client) read(ctx context.Context, conn redis.Conn, key string, vars map[string]string, ttls map[string]time.Duration) (bool, error) {
+	typ, err := redis.String(do(ctx, conn, "TYPE", key))
+	if err != nil {
+		return false, err
+	}
+	if typ != TypeString && !c.expands(typ) {
+		// none, zset, stream
+		return false, nil
+	}
+
+	cmd, args := valueCommand(typ, key)
+	reply, err := do(ctx, conn, cmd, args...)
+	if err != nil {
+		return false, err
+	}
+	added, err := addValue(typ, key, reply, vars)
+	if err != nil || len(added) == 0 || ttls == nil {
+		return len(added) > 0, err
+	}
+	reply, err = do(ctx, conn, "PTTL", key)
+	if err != nil {
+		return false, err
+	}
+	return true, setTTL(ttls, added, reply)
+}
+
+// readPage is like read for the keys of a SCAN page, but needs only two round trips:
+// the types, ttls and string values of all keys are read in one pipeline, the hashes, lists and sets in a second one.
+// The strings are read with MGET, in a cluster with single GETs as the keys can be in different hash slots.
+// Keys that are deleted in between or change their type are skipped.
+// Keys whose slot moved to another node of a cluster are read again with read, which follows the redirection.
+func (c *Client) readPage(ctx context.Context, conn redis.Conn, keys []string, vars map[string]string, ttls map[string]time.Duration) error {
+	_, isCluster := c.topo.(*cluster)
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+		if err := conn.Send("TYPE", key); err != nil {
+			return err
+		}
+	}
+	if isCluster {
+		for _, key := range keys {
+			if err := conn.Send("GET", key); err != nil {
+				return err
 			}
-			idx, _ = redis.Int(values[0], nil)
-			items, _ := redis.Strings(values[1], nil)
-			for _, item := range items {
-				var newKey string
-				if newKey, err = redis.String(item, nil); err != nil {
-					return vars, err
-				}
-				if value, err = redis.String(rClient.Do("GET", newKey)); err == nil {
-					vars[newKey] = value
-				}
+		}
+	} else if err := conn.Send("MGET", args...); err != nil {
+		return err
+	}
+	if ttls != nil {
+		for _, key := range keys {
+			if err := conn.Send("PTTL", key); err != nil {
+				return err
 			}
-			if idx == 0 {
-				break
+		}
+	}
+
+	// an empty command flushes the pipeline and returns all replies
+	replies, err := redis.Values(do(ctx, conn, ""))
+	if err != nil {
+		return err
+	}
+	values := replies[len(keys):]
+	if !isCluster {
+		if values, err = redis.Values(values[0], nil); err != nil {
+			return err
+		}
+	}
+	pttls := make([]interface{}, len(keys))
+	if ttls != nil {
+		copy(pttls, replies[len(replies)-len(keys):])
+	}
+
+	var redirected, nested, types []string
+	var nestedTTLs []interface{}
+	for i, key := range keys {
+		typ, err := redis.String(replies[i], nil)
+		if err == nil && typ == TypeString {
+			var added []string
+			if added, err = addValue(typ, key, values[i], vars); err == nil {
+				err = setTTL(ttls, added, pttls[i])
 			}
 		}
+		switch {
+		case isRedirection(err):
+			redirected = append(redirected, key)
+		case isWrongType(err):
+			// changed its type after the TYPE
+		case err != nil:
+			return err
+		case typ != TypeString && c.expands(typ):
+			nested = append(nested, key)
+			types = append(types, typ)
+			nestedTTLs = append(nestedTTLs, pttls[i])
+		}
 	}
-	return vars, nil
+
+	if len(nested) > 0 {
+		for i, key := range nested {
+			cmd, args := valueCommand(types[i], key)
+			if err := conn.Send(cmd, args...); err != nil {
+				return err
+			}
+		}
+		replies, err = redis.Values(do(ctx, conn, ""))
+		if err != nil {
+			return err
+		}
+		for i, key := range nested {
+			added, err := addValue(types[i], key, replies[i], vars)
+			if err == nil {
+				err = setTTL(ttls, added, nestedTTLs[i])
+			}
+			switch {
+			case isRedirection(err):
+				redirected = append(redirected, key)
+			case err != nil && !isWrongType(err):
+				return err
+			}
+		}
+	}
+
+	for _, key := range redirected {
+		if _, err := c.read(ctx, conn, key, vars, ttls); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setTTL adds the ttl of the PTTL reply to ttls for the keys that were added for a redis key.
+func setTTL(ttls map[string]time.Duration, added []string, reply interface{}) error {
+	if ttls == nil || len(added) == 0 {
+		return nil
+	}
+	ttl, err := redis.Int64(reply, nil)
+	if err != nil {
+		return err
+	}
+	// -1 is returned for keys without a ttl, -2 for keys that were deleted in between
+	if ttl > 0 {
+		for _, k := range added {
+			ttls[k] = time.Duration(ttl) * time.Millisecond
+		}
+	}
+	return nil
 }
 
-// WatchPrefix is not yet implemented.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
-	return 0, easykv.ErrWatchNotSupported
+// valueCommand returns the command that reads the value of key with type typ.
+func valueCommand(typ, key string) (string, []interface{}) {
+	switch typ {
+	case TypeHash:
+		return "HGETALL", []interface{}{key}
+	case TypeList:
+		return "LRANGE", []interface{}{key, 0, -1}
+	case TypeSet:
+		return "SMEMBERS", []interface{}{key}
+	}
+	return "GET", []interface{}{key}
+}
+
+// addValue adds the reply of the valueCommand of key to vars and returns the added keys.
+func addValue(typ, key string, reply interface{}, vars map[string]string) ([]string, error) {
+	var added []string
+	switch typ {
+	case TypeHash:
+		fields, err := redis.StringMap(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range fields {
+			vars[key+"/"+field] = value
+			added = append(added, key+"/"+field)
+		}
+		return added, nil
+	case TypeList, TypeSet:
+		items, err := redis.Strings(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		if typ == TypeSet {
+			sort.Strings(items)
+		}
+		for i, value := range items {
+			vars[key+"/"+strconv.Itoa(i)] = value
+			added = append(added, key+"/"+strconv.Itoa(i))
+		}
+		return added, nil
+	}
+
+	value, err := redis.String(reply, nil)
+	if err == redis.ErrNil {
+		// deleted after the TYPE
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	vars[key] = value
+	return []string{key}, nil
+}
+
+func (c *Client) expands(typ string) bool {
+	for _, t := range c.types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// do executes cmd on conn. It fails fast if ctx is already done
+// and uses the deadline of ctx as the timeout of the command.
+func do(ctx context.Context, conn redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return redis.DoWithTimeout(conn, time.Until(deadline), cmd, args...)
+	}
+	return conn.Do(cmd, args...)
+}
+
+// checkNested returns an error marked as easykv.ErrInvalid if key is a field of a hash, list or set
+// that GetValues flattens, as a string key would be created next to it instead of changing the field.
+// Every parent of key is looked up with a TYPE.
+func (c *Client) checkNested(ctx context.Context, key string) error {
+	for parent := path.Dir(key); parent != "/" && parent != "."; parent = path.Dir(parent) {
+		rClient, err := c.conn(ctx, parent)
+		if err != nil {
+			return err
+		}
+		typ, err := redis.String(do(ctx, rClient, "TYPE", parent))
+		rClient.Close()
+		if err != nil {
+			return wrapError(err)
+		}
+		if typ != TypeString && c.expands(typ) {
+			return fmt.Errorf("%w: %s is a field of the %s %s", easykv.ErrInvalid, key, typ, parent)
+		}
+	}
+	return nil
+}
+
+// Set sets the value of key.
+// Fields of the flattened hashes, lists and sets can't be set and fail with an error marked as easykv.ErrInvalid.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	if err := c.checkNested(ctx, key); err != nil {
+		return err
+	}
+	rClient, err := c.conn(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rClient.Close()
+	_, err = do(ctx, rClient, "SET", key, value)
+	return wrapError(err)
+}
+
+// refreshScript resets the ttl of KEYS[1] to ARGV[2] milliseconds if it still has the value ARGV[1].
+var refreshScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+// releaseScript deletes KEYS[1] if it still has the value ARGV[1].
+var releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// SetWithTTL sets the value of key with ttl and resets the ttl until the lease is closed.
+// It ends when the value of key is changed, closing it removes the key unless it was changed.
+// Like Set, it fails for the fields of flattened hashes, lists and sets.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	if err := c.checkNested(ctx, key); err != nil {
+		return nil, err
+	}
+	rClient, err := c.conn(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rClient.Close()
+	ms := ttl.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	if _, err := do(ctx, rClient, "SET", key, value, "PX", ms); err != nil {
+		return nil, wrapError(err)
+	}
+
+	refresh := func(ctx context.Context) error {
+		conn, err := c.conn(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		ok, err := redis.Int(refreshScript.Do(conn, key, value, ms))
+		if err != nil {
+			return wrapError(err)
+		}
+		if ok == 0 {
+			return easykv.ErrKeyNotFound
+		}
+		return nil
+	}
+	release := func(ctx context.Context) error {
+		conn, err := c.conn(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		_, err = releaseScript.Do(conn, key, value)
+		return wrapError(err)
+	}
+	return easykv.NewLease(ttl, refresh, release), nil
+}
+
+// Delete removes key.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	rClient, err := c.conn(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rClient.Close()
+	_, err = do(ctx, rClient, "DEL", key)
+	return wrapError(err)
+}
+
+// DeletePrefix removes the key prefix and all keys below it,
+// matching the keys GetValues would return for prefix.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := c.Delete(ctx, prefix); err != nil {
+		return err
+	}
+
+	match := fmt.Sprintf("%s/*", prefix)
+	if prefix == "/" {
+		match = "/*"
+	}
+
+	_, isCluster := c.topo.(*cluster)
+	return c.scan(ctx, match, func(conn redis.Conn, items []string) error {
+		args := make([]interface{}, len(items))
+		for i, item := range items {
+			args[i] = item
+		}
+		if !isCluster {
+			_, err := do(ctx, conn, "DEL", args...)
+			return wrapError(err)
+		}
+		// the keys of a multi key command have to be in the same hash slot
+		for _, arg := range args {
+			if _, err := do(ctx, conn, "DEL", arg); err != nil {
+				return wrapError(err)
+			}
+		}
+		return nil
+	})
+}
+
+// revision returns the revision GetEntries reports for value.
+// Redis keeps no revisions, so the FNV-1a hash of the value is used: a value that
+// is changed and changed back has its old revision again.
+func revision(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	if r := h.Sum64(); r != 0 {
+		return r
+	}
+	// 0 is reserved for missing keys
+	return 1
+}
+
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+// The revision of an entry is a hash of its value, see CompareAndSwap.
+// The ttls are read in the pipelines of GetValues, flattened hashes, lists and sets have the ttl of their key.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	ttls := make(map[string]time.Duration)
+	vars, err := c.getValues(ctx, keys, ttls)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]easykv.Entry, 0, len(vars))
+	for k, v := range vars {
+		list = append(list, easykv.Entry{Key: k, Value: []byte(v), Revision: revision(v), TTL: ttls[k]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// CompareAndSwap sets the value of key if the hash of its value is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return c.Commit(ctx, []easykv.Compare{{Key: key, Revision: revision}}, []easykv.TxnOp{easykv.PutOp(key, value)})
+}
+
+// commitAttempts is the number of times Commit runs a transaction that was redirected to another cluster node.
+const commitAttempts = 3
+
+// Commit applies all ops in a MULTI/EXEC block if the hashes of the values of all cmps match.
+// The keys of cmps are WATCHed while they are compared, so EXEC fails if one of them is changed in between.
+// In a cluster all keys have to be in the same hash slot, see the hash tags of redis cluster.
+// A transaction on a slot that moved to another node is run again on the new node,
+// nothing is applied before EXEC. Like Set, it fails for the fields of flattened hashes, lists and sets.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	for _, op := range ops {
+		if op.Delete {
+			continue
+		}
+		if err := c.checkNested(ctx, op.Key); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for i := 0; i < commitAttempts; i++ {
+		if err = c.commit(ctx, cmps, ops); !isRedirection(err) {
+			return err
+		}
+		c.logger.Debug("transaction redirected, retrying", "attempt", i+1, "error", err)
+	}
+	return err
+}
+
+func (c *Client) commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	var key string
+	if len(cmps) > 0 {
+		key = cmps[0].Key
+	} else if len(ops) > 0 {
+		key = ops[0].Key
+	}
+	rClient, err := c.conn(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer rClient.Close()
+
+	if len(cmps) > 0 {
+		args := make([]interface{}, len(cmps))
+		for i, cmp := range cmps {
+			args[i] = cmp.Key
+		}
+		if _, err := do(ctx, rClient, "WATCH", args...); err != nil {
+			return wrapError(err)
+		}
+	}
+
+	for _, cmp := range cmps {
+		var current uint64
+		value, err := redis.String(do(ctx, rClient, "GET", cmp.Key))
+		switch {
+		case err == nil:
+			current = revision(value)
+		case err != redis.ErrNil:
+			rClient.Do("UNWATCH")
+			return wrapError(err)
+		}
+		if current != cmp.Revision {
+			rClient.Do("UNWATCH")
+			return &easykv.ConflictError{Key: cmp.Key}
+		}
+	}
+
+	if _, err := do(ctx, rClient, "MULTI"); err != nil {
+		rClient.Do("UNWATCH")
+		return wrapError(err)
+	}
+	for _, op := range ops {
+		if op.Delete {
+			_, err = do(ctx, rClient, "DEL", op.Key)
+		} else {
+			_, err = do(ctx, rClient, "SET", op.Key, op.Value)
+		}
+		if err != nil {
+			rClient.Do("DISCARD")
+			return wrapError(err)
+		}
+	}
+
+	_, err = redis.Values(do(ctx, rClient, "EXEC"))
+	if err == redis.ErrNil {
+		// a watched key was changed after the compare
+		return &easykv.ConflictError{}
+	}
+	return wrapError(err)
+}
+
+// Capabilities reports the features of redis, its revisions are hashes of the values.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Transactions: true, Revisions: true, BinaryValues: true}
+}
+
+// Ping sends a PING to every master, connecting again if a connection was lost.
+func (c *Client) Ping(ctx context.Context) error {
+	conns, err := c.topo.masters(ctx)
+	if err != nil {
+		return wrapError(err)
+	}
+	defer closeAll(conns)
+	for _, conn := range conns {
+		if _, err := do(ctx, conn, "PING"); err != nil {
+			return wrapError(err)
+		}
+	}
+	return nil
 }
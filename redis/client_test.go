@@ -9,9 +9,18 @@
 package redis
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
+	"github.com/garyburd/redigo/redis"
 
 	. "gopkg.in/check.v1"
 )
@@ -23,28 +32,570 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New([]string{"localhost:6379"}, WithKeyspaceNotifications(true))
+		t.Assert(err, IsNil)
+		return c
+	},
+	NoWaitIndex: true,
+})
+
+// command runs a command with a key as first argument on a connection of the pool.
+func command(c *Client, cmd string, key string, args ...interface{}) {
+	conn, err := c.conn(context.Background(), key)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Do(cmd, append([]interface{}{key}, args...)...)
+}
+
 func (s *FilterSuite) TestGetValues(t *C) {
 	c, err := New([]string{"localhost:6379"})
 	if err != nil {
 		t.Error(err)
 	}
 
-	c.client.Do("SET", "/premtest/database/url", "www.google.de")
-	c.client.Do("SET", "/premtest/database/user", "Boris")
-	c.client.Do("SET", "/remtest/database/hosts/0/name", "test1")
-	c.client.Do("SET", "/remtest/database/hosts/0/ip", "192.168.0.1")
-	c.client.Do("SET", "/remtest/database/hosts/0/size", "60")
-	c.client.Do("SET", "/remtest/database/hosts/1/name", "test2")
-	c.client.Do("SET", "/remtest/database/hosts/1/ip", "192.168.0.2")
-	c.client.Do("SET", "/remtest/database/hosts/1/size", "80")
+	command(c, "SET", "/premtest/database/url", "www.google.de")
+	command(c, "SET", "/premtest/database/user", "Boris")
+	command(c, "SET", "/remtest/database/hosts/0/name", "test1")
+	command(c, "SET", "/remtest/database/hosts/0/ip", "192.168.0.1")
+	command(c, "SET", "/remtest/database/hosts/0/size", "60")
+	command(c, "SET", "/remtest/database/hosts/1/name", "test2")
+	command(c, "SET", "/remtest/database/hosts/1/ip", "192.168.0.2")
+	command(c, "SET", "/remtest/database/hosts/1/size", "80")
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchPrefix(t *C) {
+	c, err := New([]string{"localhost:6379"}, WithKeyspaceNotifications(true))
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		command(c, "SET", "/watchtest/other", "value")
+		command(c, "SET", "/watchtest/database/url", "www.google.de")
+	}()
+	index := testutils.WatchPrefix(context.Background(), t, c, "/watchtest", []string{"/watchtest/database"})
+	t.Check(index, Equals, uint64(1))
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		command(c, "DEL", "/watchtest/database/url")
+	}()
+	index, err = c.WatchPrefix(context.Background(), "/watchtest", easykv.WithWaitIndex(10))
+	t.Check(err, IsNil)
+	t.Check(index, Equals, uint64(11))
+	command(c, "DEL", "/watchtest/other")
+}
+
+func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
+	c, err := New([]string{"localhost:6379"}, WithKeyspaceNotifications(true))
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	index, err := c.WatchPrefix(ctx, "/watchtest", easykv.WithWaitIndex(3))
+	t.Check(err, Equals, easykv.ErrWatchCanceled)
+	t.Check(index, Equals, uint64(3))
+}
+
+func (s *FilterSuite) TestPattern(t *C) {
+	t.Check(patternReplacer.Replace("/app/[a]*?"), Equals, `/app/\[a\]\*\?`)
+	t.Check(notifies(""), Equals, false)
+	t.Check(notifies("KEA"), Equals, true)
+	t.Check(notifies("Kg$"), Equals, true)
+	t.Check(notifies("Eg$"), Equals, false)
+}
+
+func (s *FilterSuite) TestWriter(t *C) {
 	c, err := New([]string{"localhost:6379"})
 	if err != nil {
 		t.Error(err)
 	}
-	testutils.WatchPrefixError(t, c)
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestPoolConcurrent(t *C) {
+	srv, err := newFakeServer(map[string]string{
+		"/app/name":         "easykv",
+		"/app/database/url": "www.google.de",
+		"/other/key":        "value",
+	})
+	t.Assert(err, IsNil)
+	defer srv.Close()
+
+	c, err := New([]string{srv.Addr()}, WithMaxActive(2))
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := c.GetValues([]string{"/app"})
+			t.Check(err, IsNil)
+			t.Check(values, DeepEquals, map[string]string{
+				"/app/name":         "easykv",
+				"/app/database/url": "www.google.de",
+			})
+		}()
+	}
+	wg.Wait()
+
+	_, maxConn := srv.stats()
+	t.Check(maxConn <= 2, Equals, true, Commentf("%d connections", maxConn))
+}
+
+func (s *FilterSuite) TestPoolFailover(t *C) {
+	srv, err := newFakeServer(map[string]string{"/app/name": "easykv"})
+	t.Assert(err, IsNil)
+	defer srv.Close()
+
+	// a closed port in front of the reachable server
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Assert(err, IsNil)
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	c, err := New([]string{unreachable, srv.Addr()})
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{"/app/name": "easykv"})
+	t.Check(c.Ping(context.Background()), IsNil)
+
+	dials, _ := srv.stats()
+	t.Check(dials, Equals, 1)
+}
+
+func (s *FilterSuite) TestNewUnreachable(t *C) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	t.Assert(err, IsNil)
+	unreachable := ln.Addr().String()
+	ln.Close()
+
+	_, err = New([]string{unreachable})
+	t.Check(errors.Is(err, easykv.ErrUnavailable), Equals, true)
+}
+
+func (s *FilterSuite) TestSlot(t *C) {
+	t.Check(crc16("123456789"), Equals, uint16(0x31C3))
+	t.Check(slot("foo"), Equals, 12182)
+	t.Check(slot("{user1000}.following"), Equals, slot("{user1000}.followers"))
+	// an empty hash tag hashes the whole key
+	t.Check(slot("foo{}{bar}"), Equals, int(crc16("foo{}{bar}")%clusterSlots))
+}
+
+func (s *FilterSuite) TestCluster(t *C) {
+	a, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer a.Close()
+	b, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer b.Close()
+
+	cl := &fakeCluster{ranges: []fakeRange{{0, 8191, a}, {8192, clusterSlots - 1, b}}}
+	a.cluster, b.cluster = cl, cl
+
+	c, err := New([]string{a.Addr()}, WithCluster())
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	ctx := context.Background()
+	want := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("/app/key%d", i)
+		want[key] = strconv.Itoa(i)
+		t.Assert(c.Set(ctx, key, want[key]), IsNil)
+	}
+	// the keys are spread over both masters
+	t.Check(len(a.keys()) > 0 && len(b.keys()) > 0, Equals, true)
+	t.Check(len(a.keys())+len(b.keys()), Equals, 10)
+
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, want)
+	t.Check(c.Ping(ctx), IsNil)
+
+	// move all slots to a, the stale slot map is reloaded on the MOVED redirection
+	a.mu.Lock()
+	b.mu.Lock()
+	for k, v := range b.values {
+		a.values[k] = v
+	}
+	b.values = make(map[string]interface{})
+	b.mu.Unlock()
+	a.mu.Unlock()
+	cl.mu.Lock()
+	cl.ranges = []fakeRange{{0, clusterSlots - 1, a}}
+	cl.mu.Unlock()
+
+	for k, v := range want {
+		values, err := c.GetValues([]string{k})
+		t.Check(err, IsNil)
+		t.Check(values, DeepEquals, map[string]string{k: v})
+	}
+	values, err = c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, want)
+
+	t.Assert(c.DeletePrefix(ctx, "/app"), IsNil)
+	t.Check(a.keys(), HasLen, 0)
+}
+
+func (s *FilterSuite) TestClusterCommit(t *C) {
+	a, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer a.Close()
+	b, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer b.Close()
+
+	cl := &fakeCluster{ranges: []fakeRange{{0, 8191, a}, {8192, clusterSlots - 1, b}}}
+	a.cluster, b.cluster = cl, cl
+
+	c, err := New([]string{a.Addr()}, WithCluster())
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	// a key on b
+	key := "/app/key0"
+	for i := 1; slot(key) < 8192; i++ {
+		key = fmt.Sprintf("/app/key%d", i)
+	}
+	ctx := context.Background()
+	t.Assert(c.Set(ctx, key, "old"), IsNil)
+	t.Check(b.keys(), DeepEquals, []string{key})
+
+	// move all slots to a, the transaction fails on b and is run again on a
+	a.mu.Lock()
+	b.mu.Lock()
+	a.values[key] = b.values[key]
+	b.values = make(map[string]interface{})
+	b.mu.Unlock()
+	a.mu.Unlock()
+	cl.mu.Lock()
+	cl.ranges = []fakeRange{{0, clusterSlots - 1, a}}
+	cl.mu.Unlock()
+
+	t.Assert(c.CompareAndSwap(ctx, key, revision("old"), "new"), IsNil)
+	t.Check(b.keys(), HasLen, 0)
+	values, err := c.GetValues([]string{key})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{key: "new"})
+}
+
+func (s *FilterSuite) TestClusterMigrating(t *C) {
+	a, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer a.Close()
+	b, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer b.Close()
+
+	cl := &fakeCluster{ranges: []fakeRange{{0, 8191, a}, {8192, clusterSlots - 1, b}}}
+	a.cluster, b.cluster = cl, cl
+
+	c, err := New([]string{a.Addr()}, WithCluster(), WithTypes(TypeHash))
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	ctx := context.Background()
+	want := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("/app/key%d", i)
+		want[key] = strconv.Itoa(i)
+		t.Assert(c.Set(ctx, key, want[key]), IsNil)
+	}
+	// a hash on b
+	hash := "/app/hash0"
+	for i := 1; slot(hash) < 8192; i++ {
+		hash = fmt.Sprintf("/app/hash%d", i)
+	}
+	b.mu.Lock()
+	b.values[hash] = map[string]string{"a": "1"}
+	b.mu.Unlock()
+	want[hash+"/a"] = "1"
+
+	// the keys of b are migrated to a, a lists them in its SCAN pages,
+	// but redirects their commands to b, which asks for them on a
+	a.mu.Lock()
+	b.mu.Lock()
+	for k, v := range b.values {
+		a.values[k] = v
+	}
+	b.values = make(map[string]interface{})
+	b.mu.Unlock()
+	a.mu.Unlock()
+	cl.mu.Lock()
+	cl.migrating = a
+	cl.mu.Unlock()
+
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, want)
+}
+
+func (s *FilterSuite) TestSentinel(t *C) {
+	master1, err := newFakeServer(map[string]string{"/app/name": "master1"})
+	t.Assert(err, IsNil)
+	defer master1.Close()
+	master2, err := newFakeServer(map[string]string{"/app/name": "master2"})
+	t.Assert(err, IsNil)
+	defer master2.Close()
+	sentinel, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer sentinel.Close()
+	sentinel.masters = map[string]string{"mymaster": master1.Addr()}
+
+	_, err = New([]string{sentinel.Addr()}, WithSentinel("unknown"))
+	t.Check(errors.Is(err, easykv.ErrUnavailable), Equals, true)
+
+	c, err := New([]string{sentinel.Addr()}, WithSentinel("mymaster"))
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{"/app/name": "master1"})
+
+	// failover: the sentinel kills the clients of the demoted master
+	sentinel.mu.Lock()
+	sentinel.masters["mymaster"] = master2.Addr()
+	sentinel.mu.Unlock()
+	master1.mu.Lock()
+	master1.role = "slave"
+	master1.mu.Unlock()
+	master1.kill()
+	time.Sleep(testOnBorrowAfter + 100*time.Millisecond)
+
+	values, err = c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{"/app/name": "master2"})
+}
+
+func (s *FilterSuite) TestTypesSet(t *C) {
+	srv, err := newFakeServer(map[string]string{"/app/name": "easykv"})
+	t.Assert(err, IsNil)
+	defer srv.Close()
+	srv.values["/app/database"] = map[string]string{"url": "www.google.de"}
+	srv.values["/app/hosts"] = []string{"test1"}
+
+	c, err := New([]string{srv.Addr()})
+	t.Assert(err, IsNil)
+	defer c.Close()
+	ctx := context.Background()
+
+	// the fields of a flattened hash or list can't be set as string keys
+	err = c.Set(ctx, "/app/database/url", "www.example.com")
+	t.Check(errors.Is(err, easykv.ErrInvalid), Equals, true)
+	_, err = c.SetWithTTL(ctx, "/app/hosts/1", "test2", time.Minute)
+	t.Check(errors.Is(err, easykv.ErrInvalid), Equals, true)
+	err = c.Commit(ctx, nil, []easykv.TxnOp{easykv.PutOp("/app/database/user", "Boris")})
+	t.Check(errors.Is(err, easykv.ErrInvalid), Equals, true)
+	t.Check(srv.values["/app/database/url"], IsNil)
+	t.Check(srv.values["/app/hosts/1"], IsNil)
+	t.Check(srv.values["/app/database/user"], IsNil)
+
+	t.Assert(c.Set(ctx, "/app/name", "easyKV"), IsNil)
+	t.Check(srv.values["/app/name"], Equals, "easyKV")
+
+	// lists aren't flattened, so the key is a string key of its own
+	c, err = New([]string{srv.Addr()}, WithTypes(TypeHash))
+	t.Assert(err, IsNil)
+	defer c.Close()
+	t.Assert(c.Set(ctx, "/app/hosts/1", "test2"), IsNil)
+	t.Check(srv.values["/app/hosts/1"], Equals, "test2")
+}
+
+func (s *FilterSuite) TestTypes(t *C) {
+	srv, err := newFakeServer(map[string]string{"/app/name": "easykv"})
+	t.Assert(err, IsNil)
+	defer srv.Close()
+	srv.values["/app/database"] = map[string]string{"url": "www.google.de", "user": "Boris"}
+	srv.values["/app/hosts"] = []string{"test1", "test2"}
+	srv.values["/app/tags"] = fakeSet{"b", "a"}
+
+	c, err := New([]string{srv.Addr()})
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{
+		"/app/name":          "easykv",
+		"/app/database/url":  "www.google.de",
+		"/app/database/user": "Boris",
+		"/app/hosts/0":       "test1",
+		"/app/hosts/1":       "test2",
+		"/app/tags/0":        "a",
+		"/app/tags/1":        "b",
+	})
+
+	// the hash itself
+	values, err = c.GetValues([]string{"/app/database"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{
+		"/app/database/url":  "www.google.de",
+		"/app/database/user": "Boris",
+	})
+
+	c, err = New([]string{srv.Addr()}, WithTypes(TypeHash))
+	t.Assert(err, IsNil)
+	defer c.Close()
+	values, err = c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, map[string]string{
+		"/app/name":          "easykv",
+		"/app/database/url":  "www.google.de",
+		"/app/database/user": "Boris",
+	})
+}
+
+func (s *FilterSuite) TestMatchKeys(t *C) {
+	t.Check(matchKeys("/app/name", nil), Equals, true)
+	t.Check(matchKeys("/app/name", []string{"/app"}), Equals, true)
+	t.Check(matchKeys("/app/database", []string{"/app/database/url"}), Equals, true)
+	t.Check(matchKeys("/app/data", []string{"/app/database/url"}), Equals, false)
+	t.Check(matchKeys("/other", []string{"/app"}), Equals, false)
+}
+
+func (s *FilterSuite) TestScanCount(t *C) {
+	srv, err := newFakeServer(nil)
+	t.Assert(err, IsNil)
+	defer srv.Close()
+	want := map[string]string{"/app/hash/url": "www.google.de"}
+	srv.values["/app/hash"] = map[string]string{"url": "www.google.de"}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("/app/key%d", i)
+		srv.values[key] = strconv.Itoa(i)
+		want[key] = strconv.Itoa(i)
+	}
+
+	c, err := New([]string{srv.Addr()}, WithScanCount(4))
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	srv.roundTrips()
+	values, err := c.GetValues([]string{"/app"})
+	t.Assert(err, IsNil)
+	t.Check(values, DeepEquals, want)
+	// the TYPE of /app, 3 pages with a SCAN and a pipeline each
+	// and another pipeline for the hash in the first page
+	t.Check(srv.roundTrips(), Equals, 8)
+}
+
+func (s *FilterSuite) TestGetEntriesTTL(t *C) {
+	srv, err := newFakeServer(map[string]string{"/app/name": "easykv", "/app/port": "80"})
+	t.Assert(err, IsNil)
+	defer srv.Close()
+	srv.values["/app/hosts"] = []string{"test1", "test2"}
+	srv.ttls["/app/hosts"] = 5000
+	srv.ttls["/app/name"] = 2000
+
+	c, err := New([]string{srv.Addr()})
+	t.Assert(err, IsNil)
+	defer c.Close()
+
+	srv.roundTrips()
+	entries, err := c.GetEntries(context.Background(), []string{"/app"})
+	t.Assert(err, IsNil)
+	ttls := make(map[string]time.Duration)
+	for _, e := range entries {
+		ttls[e.Key] = e.TTL
+	}
+	t.Check(ttls, DeepEquals, map[string]time.Duration{
+		"/app/hosts/0": 5 * time.Second,
+		"/app/hosts/1": 5 * time.Second,
+		"/app/name":    2 * time.Second,
+		"/app/port":    0,
+	})
+	// the TYPE of /app, the SCAN, the pipeline with the ttls and the one for the list
+	t.Check(srv.roundTrips(), Equals, 4)
+
+	// a single key
+	entries, err = c.GetEntries(context.Background(), []string{"/app/hosts"})
+	t.Assert(err, IsNil)
+	t.Assert(entries, HasLen, 2)
+	t.Check(entries[0].TTL, Equals, 5*time.Second)
+}
+
+// benchmarkServer returns a server with n string keys and n/10 hashes below /app
+// that adds latency to every round trip, like a redis server on another host.
+func benchmarkServer(b *testing.B, n int) *fakeServer {
+	srv, err := newFakeServer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		srv.values[fmt.Sprintf("/app/key%d", i)] = strconv.Itoa(i)
+	}
+	for i := 0; i < n/10; i++ {
+		srv.values[fmt.Sprintf("/app/hash%d", i)] = map[string]string{"a": "1", "b": "2"}
+	}
+	srv.delay = 100 * time.Microsecond
+	return srv
+}
+
+func BenchmarkGetValues(b *testing.B) {
+	srv := benchmarkServer(b, 1000)
+	defer srv.Close()
+
+	for _, count := range []int{100, DefaultScanCount} {
+		b.Run(fmt.Sprintf("count=%d", count), func(b *testing.B) {
+			c, err := New([]string{srv.Addr()}, WithScanCount(count))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer c.Close()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.GetValues([]string{"/app"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkGetValuesUnbatched reads every key on its own for comparison.
+func BenchmarkGetValuesUnbatched(b *testing.B) {
+	srv := benchmarkServer(b, 1000)
+	defer srv.Close()
+
+	c, err := New([]string{srv.Addr()})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		vars := make(map[string]string)
+		err := c.scan(ctx, "/app*", func(conn redis.Conn, keys []string) error {
+			for _, key := range keys {
+				if _, err := c.read(ctx, conn, key, vars, nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,45 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package redis
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/garyburd/redigo/redis"
+)
+
+// wrapError marks the errors of the redis client with the easykv error kinds.
+func wrapError(err error) error {
+	if err == redis.ErrNil {
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	}
+
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		msg := redisErr.Error()
+		if strings.HasPrefix(msg, "NOAUTH") || strings.HasPrefix(msg, "WRONGPASS") ||
+			strings.HasPrefix(msg, "NOPERM") || strings.Contains(msg, "invalid password") {
+			return easykv.WrapError(easykv.ErrUnauthorized, err)
+		}
+		if strings.HasPrefix(msg, "LOADING") || strings.HasPrefix(msg, "MASTERDOWN") ||
+			strings.HasPrefix(msg, "CLUSTERDOWN") || strings.HasPrefix(msg, "TRYAGAIN") || isRedirection(err) {
+			return easykv.WrapError(easykv.ErrUnavailable, err)
+		}
+		return err
+	}
+	return easykv.ClassifyError(err)
+}
+
+// isWrongType reports whether err is the WRONGTYPE error of a command on a key with another type.
+func isWrongType(err error) bool {
+	var redisErr redis.Error
+	return errors.As(err, &redisErr) && strings.HasPrefix(string(redisErr), "WRONGTYPE")
+}
@@ -0,0 +1,485 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeServer is a minimal in-memory redis server speaking RESP,
+// it implements the commands used by the client for the tests that can't rely on a real server.
+type fakeServer struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	values  map[string]interface{} // string, map[string]string (hash), []string (list) or fakeSet
+	ttls    map[string]int64       // PTTL of the keys with a ttl
+	conns   map[net.Conn]struct{}
+	maxConn int // most connections open at the same time
+	dials   int
+	trips   int           // round trips, a pipeline counts once
+	delay   time.Duration // latency added to every round trip
+
+	role    string            // reply of ROLE, defaults to master
+	masters map[string]string // master addresses the server knows as sentinel
+	cluster *fakeCluster      // the cluster the server is a node of
+}
+
+// fakeCluster assigns the hash slots to the nodes.
+type fakeCluster struct {
+	mu     sync.Mutex
+	ranges []fakeRange
+	// the node all slots are migrated to, the owners of the slots reply ASK for the keys they don't store
+	migrating *fakeServer
+}
+
+type fakeRange struct {
+	start, end int
+	node       *fakeServer
+}
+
+func (c *fakeCluster) owner(slot int) *fakeServer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.ranges {
+		if slot >= r.start && slot <= r.end {
+			return r.node
+		}
+	}
+	return nil
+}
+
+func (c *fakeCluster) target() *fakeServer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.migrating
+}
+
+func (c *fakeCluster) slots() interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply := make([]interface{}, 0, len(c.ranges))
+	for _, r := range c.ranges {
+		host, port, _ := net.SplitHostPort(r.node.Addr())
+		p, _ := strconv.Atoi(port)
+		reply = append(reply, []interface{}{int64(r.start), int64(r.end), []interface{}{host, int64(p)}})
+	}
+	return reply
+}
+
+func newFakeServer(values map[string]string) (*fakeServer, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &fakeServer{ln: ln, values: make(map[string]interface{}), ttls: make(map[string]int64), conns: make(map[net.Conn]struct{})}
+	for k, v := range values {
+		s.values[k] = v
+	}
+	go s.serve()
+	return s, nil
+}
+
+func (s *fakeServer) Addr() string { return s.ln.Addr().String() }
+
+func (s *fakeServer) Close() {
+	s.ln.Close()
+	s.kill()
+}
+
+// kill closes all client connections.
+func (s *fakeServer) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeServer) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (s *fakeServer) stats() (dials, maxConn int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dials, s.maxConn
+}
+
+// roundTrips returns the number of round trips since the last call.
+func (s *fakeServer) roundTrips() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	trips := s.trips
+	s.trips = 0
+	return trips
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.dials++
+		s.conns[conn] = struct{}{}
+		if len(s.conns) > s.maxConn {
+			s.maxConn = len(s.conns)
+		}
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	var state fakeConn
+	for {
+		if r.Buffered() == 0 {
+			// the replies of a pipeline are sent together
+			if err := w.Flush(); err != nil {
+				return
+			}
+			if _, err := r.Peek(1); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.trips++
+			delay := s.delay
+			s.mu.Unlock()
+			time.Sleep(delay)
+		}
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		reply := s.execConn(&state, args)
+		s.mu.Unlock()
+		writeReply(w, reply)
+	}
+}
+
+// fakeConn is the state of a connection.
+type fakeConn struct {
+	tx     *fakeTx // the MULTI block
+	asking bool    // the next command is allowed on the slots migrated to the server
+}
+
+// fakeTx is the MULTI block of a connection. WATCH only checks the slot of its keys.
+type fakeTx struct {
+	queued  [][]string
+	aborted bool
+}
+
+// execConn runs a command of the connection c, s.mu is held.
+func (s *fakeServer) execConn(c *fakeConn, args []string) interface{} {
+	asking := c.asking
+	c.asking = false
+
+	switch strings.ToUpper(args[0]) {
+	case "ASKING":
+		c.asking = true
+		return status("OK")
+	case "WATCH":
+		if err := s.redirect(args, asking); err != nil {
+			return err
+		}
+		return status("OK")
+	case "UNWATCH":
+		return status("OK")
+	case "MULTI":
+		c.tx = &fakeTx{}
+		return status("OK")
+	case "DISCARD":
+		c.tx = nil
+		return status("OK")
+	case "EXEC":
+		tx := c.tx
+		c.tx = nil
+		if tx == nil {
+			return redisError("ERR EXEC without MULTI")
+		}
+		if tx.aborted {
+			return redisError("EXECABORT Transaction discarded because of previous errors.")
+		}
+		replies := make([]interface{}, len(tx.queued))
+		for i, queued := range tx.queued {
+			replies[i] = s.exec(queued)
+		}
+		return replies
+	}
+	if err := s.redirect(args, asking); err != nil {
+		if c.tx != nil {
+			c.tx.aborted = true
+		}
+		return err
+	}
+	if c.tx == nil {
+		return s.exec(args)
+	}
+	c.tx.queued = append(c.tx.queued, args)
+	return status("QUEUED")
+}
+
+// redirect returns the MOVED error if the key of a command belongs to another node of the cluster,
+// and the ASK error if the key was migrated to another node.
+func (s *fakeServer) redirect(args []string, asking bool) interface{} {
+	if s.cluster == nil || len(args) < 2 {
+		return nil
+	}
+	switch strings.ToUpper(args[0]) {
+	case "GET", "SET", "DEL", "PTTL", "TYPE", "HGETALL", "LRANGE", "SMEMBERS", "WATCH":
+	default:
+		return nil
+	}
+
+	key := args[1]
+	target := s.cluster.target()
+	if owner := s.cluster.owner(slot(key)); owner != s {
+		if asking && target == s {
+			return nil
+		}
+		return redisError(fmt.Sprintf("MOVED %d %s", slot(key), owner.Addr()))
+	}
+	if _, ok := s.values[key]; !ok && target != nil && target != s {
+		return redisError(fmt.Sprintf("ASK %d %s", slot(key), target.Addr()))
+	}
+	return nil
+}
+
+// fakeSet is a set value, the members are returned in the given order.
+type fakeSet []string
+
+type status string
+
+type redisError string
+
+// exec runs a command, s.mu is held.
+func (s *fakeServer) exec(args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "ROLE":
+		role := s.role
+		if role == "" {
+			role = "master"
+		}
+		return []interface{}{role, int64(0), []interface{}{}}
+	case "SENTINEL":
+		address, ok := s.masters[args[2]]
+		if !ok {
+			return nil
+		}
+		host, port, _ := net.SplitHostPort(address)
+		return []interface{}{host, port}
+	case "CLUSTER":
+		return s.cluster.slots()
+	case "PING":
+		return status("PONG")
+	case "SELECT", "AUTH":
+		return status("OK")
+	case "GET":
+		switch v := s.values[args[1]].(type) {
+		case nil:
+			return nil
+		case string:
+			return v
+		}
+		return wrongType
+	case "MGET":
+		values := make([]interface{}, 0, len(args)-1)
+		for _, k := range args[1:] {
+			if v, ok := s.values[k].(string); ok {
+				values = append(values, v)
+			} else {
+				values = append(values, nil)
+			}
+		}
+		return values
+	case "PTTL":
+		if _, ok := s.values[args[1]]; !ok {
+			return int64(-2)
+		}
+		if ttl, ok := s.ttls[args[1]]; ok {
+			return ttl
+		}
+		return int64(-1)
+	case "TYPE":
+		switch s.values[args[1]].(type) {
+		case string:
+			return status("string")
+		case map[string]string:
+			return status("hash")
+		case []string:
+			return status("list")
+		case fakeSet:
+			return status("set")
+		}
+		return status("none")
+	case "HGETALL":
+		h, _ := s.values[args[1]].(map[string]string)
+		fields := make([]string, 0, len(h))
+		for f := range h {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		reply := make([]interface{}, 0, 2*len(h))
+		for _, f := range fields {
+			reply = append(reply, f, h[f])
+		}
+		return reply
+	case "LRANGE":
+		l, _ := s.values[args[1]].([]string)
+		return strings2values(l)
+	case "SMEMBERS":
+		m, _ := s.values[args[1]].(fakeSet)
+		return strings2values(m)
+	case "SET":
+		s.values[args[1]] = args[2]
+		return status("OK")
+	case "DEL":
+		n := int64(0)
+		for _, k := range args[1:] {
+			if _, ok := s.values[k]; ok {
+				delete(s.values, k)
+				n++
+			}
+		}
+		return n
+	case "SCAN":
+		return s.scan(args)
+	}
+	return redisError("ERR unknown command '" + args[0] + "'")
+}
+
+const wrongType = redisError("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+func strings2values(items []string) []interface{} {
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		values[i] = item
+	}
+	return values
+}
+
+// scan returns the keys in pages of COUNT keys, the cursor is the offset in the sorted keys.
+func (s *fakeServer) scan(args []string) interface{} {
+	cursor, _ := strconv.Atoi(args[1])
+	match, count := "*", 10
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			count, _ = strconv.Atoi(args[i+1])
+		}
+	}
+
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	end := cursor + count
+	next := end
+	if end >= len(keys) {
+		end, next = len(keys), 0
+	}
+	var page []interface{}
+	for _, k := range keys[cursor:end] {
+		if matchPattern(match, k) {
+			page = append(page, k)
+		}
+	}
+	return []interface{}{strconv.Itoa(next), page}
+}
+
+// matchPattern supports the patterns used by the client: a literal key or a prefix followed by *.
+func matchPattern(pattern, key string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(key, prefix)
+	}
+	return pattern == key
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case redisError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	}
+}
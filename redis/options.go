@@ -8,6 +8,11 @@
 
 package redis
 
+import (
+	"log/slog"
+	"time"
+)
+
 // Option configures the redis client.
 type Option func(*Client)
 
@@ -24,3 +29,73 @@ func WithDatabase(db int) Option {
 		o.db = db
 	}
 }
+
+// WithLogger sets the logger for connects and reconnects, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Client) {
+		o.logger = l
+	}
+}
+
+// WithKeyspaceNotifications lets WatchPrefix enable the keyspace notifications
+// with CONFIG SET notify-keyspace-events if they are disabled on the server.
+func WithKeyspaceNotifications(b bool) Option {
+	return func(o *Client) {
+		o.notifyConfig = b
+	}
+}
+
+// WithMaxIdle sets the maximum number of idle connections in the pool, it defaults to DefaultMaxIdle.
+func WithMaxIdle(n int) Option {
+	return func(o *Client) {
+		o.maxIdle = n
+	}
+}
+
+// WithMaxActive limits the number of connections of the pool.
+// Calls wait for a free connection if the limit is reached. The default of 0 means no limit.
+func WithMaxActive(n int) Option {
+	return func(o *Client) {
+		o.maxActive = n
+	}
+}
+
+// WithIdleTimeout closes connections that were idle for longer than d, it defaults to DefaultIdleTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *Client) {
+		o.idleTimeout = d
+	}
+}
+
+// WithSentinel asks the sentinels passed as machines to New for the address of the master with name.
+// The master is resolved again for every new connection, so the client follows failovers.
+func WithSentinel(name string) Option {
+	return func(o *Client) {
+		o.sentinelMaster = name
+	}
+}
+
+// WithCluster connects to a redis cluster, the machines passed to New are the seed nodes.
+// The keys are routed to the masters by their hash slot and scans cover every master.
+// A cluster only has database 0.
+func WithCluster() Option {
+	return func(o *Client) {
+		o.cluster = true
+	}
+}
+
+// WithTypes selects the value types besides strings that are flattened into nested keys:
+// TypeHash, TypeList and TypeSet. All of them are flattened by default, keys of other types are skipped.
+func WithTypes(types ...string) Option {
+	return func(o *Client) {
+		o.types = types
+	}
+}
+
+// WithScanCount sets the COUNT hint of the SCAN commands, it defaults to DefaultScanCount.
+// The keys of every SCAN page are read in one pipeline, so larger pages need fewer round trips.
+func WithScanCount(n int) Option {
+	return func(o *Client) {
+		o.scanCount = n
+	}
+}
@@ -0,0 +1,425 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/garyburd/redigo/redis"
+)
+
+// topology hands out the connections to the redis servers of a deployment.
+type topology interface {
+	// conn returns a pooled connection to the master that serves key.
+	conn(ctx context.Context, key string) (redis.Conn, error)
+	// masters returns a pooled connection to every master, the keys are spread over them.
+	masters(ctx context.Context) ([]redis.Conn, error)
+	// dialMasters dials a connection to every master that isn't pooled, e.g. for subscriptions.
+	dialMasters() ([]redis.Conn, error)
+	close() error
+}
+
+// single is a standalone server or the master of a sentinel group.
+type single struct {
+	pool *redis.Pool
+	dial func() (redis.Conn, error)
+}
+
+func (s *single) conn(ctx context.Context, key string) (redis.Conn, error) {
+	return s.pool.GetContext(ctx)
+}
+
+func (s *single) masters(ctx context.Context) ([]redis.Conn, error) {
+	conn, err := s.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []redis.Conn{conn}, nil
+}
+
+func (s *single) dialMasters() ([]redis.Conn, error) {
+	conn, err := s.dial()
+	if err != nil {
+		return nil, err
+	}
+	return []redis.Conn{conn}, nil
+}
+
+func (s *single) close() error {
+	return s.pool.Close()
+}
+
+// resolveMaster asks the sentinels for the address of the master with name
+// and dials it. The first sentinel that knows the master is used.
+func resolveMaster(sentinels []string, name string, db int, password string, logger *slog.Logger) (redis.Conn, error) {
+	err := fmt.Errorf("no sentinel knows master %q", name)
+	for _, address := range sentinels {
+		conn, dialErr := redis.Dial("tcp", address, redis.DialConnectTimeout(time.Second),
+			redis.DialReadTimeout(time.Second), redis.DialWriteTimeout(time.Second))
+		if dialErr != nil {
+			logger.Warn("sentinel unreachable", "address", address, "error", dialErr)
+			err = dialErr
+			continue
+		}
+		addr, getErr := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", name))
+		conn.Close()
+		if getErr != nil || len(addr) != 2 {
+			logger.Warn("sentinel doesn't know the master", "address", address, "master", name, "error", getErr)
+			continue
+		}
+
+		master := net.JoinHostPort(addr[0], addr[1])
+		logger.Debug("master resolved", "sentinel", address, "master", name, "address", master)
+		conn, err = tryConnect([]string{master}, db, password, logger)
+		if err != nil {
+			return nil, err
+		}
+		// the sentinels may not have noticed a failover yet
+		if err := checkMaster(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+	return nil, easykv.WrapError(easykv.ErrUnavailable, err)
+}
+
+// checkMaster returns an error if conn isn't connected to a master.
+func checkMaster(conn redis.Conn) error {
+	role, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(role) == 0 {
+		return errors.New("empty ROLE reply")
+	}
+	if r, _ := redis.String(role[0], nil); r != "master" {
+		return easykv.WrapError(easykv.ErrUnavailable, fmt.Errorf("server is a %s, not a master", r))
+	}
+	return nil
+}
+
+// clusterSlots is the number of hash slots of a redis cluster.
+const clusterSlots = 16384
+
+// maxRedirects is the number of MOVED and ASK redirections followed for a command.
+const maxRedirects = 5
+
+// cluster routes the keys to the masters of a redis cluster by their hash slot.
+type cluster struct {
+	seeds   []string
+	dial    func(address string) (redis.Conn, error)
+	newPool func(dial func() (redis.Conn, error)) *redis.Pool
+	logger  *slog.Logger
+
+	mu    sync.RWMutex
+	slots []string // address of the master of every slot
+	pools map[string]*redis.Pool
+}
+
+// refresh loads the slot map with CLUSTER SLOTS from one of the known masters or seed nodes.
+func (c *cluster) refresh() error {
+	c.mu.RLock()
+	addresses := append(c.addresses(), c.seeds...)
+	c.mu.RUnlock()
+
+	var err error
+	for _, address := range addresses {
+		var slots []string
+		slots, err = c.fetchSlots(address)
+		if err != nil {
+			c.logger.Warn("can't load the cluster slots", "address", address, "error", err)
+			continue
+		}
+
+		c.mu.Lock()
+		c.slots = slots
+		for _, master := range c.addresses() {
+			if _, ok := c.pools[master]; !ok {
+				c.pools[master] = c.newPool(func() (redis.Conn, error) { return c.dial(master) })
+			}
+		}
+		c.mu.Unlock()
+		c.logger.Debug("cluster slots loaded", "address", address)
+		return nil
+	}
+	return err
+}
+
+func (c *cluster) fetchSlots(address string) ([]string, error) {
+	conn, err := c.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(address)
+
+	slots := make([]string, clusterSlots)
+	for _, r := range reply {
+		// start, end, master, replicas...
+		slotRange, err := redis.Values(r, nil)
+		if err != nil || len(slotRange) < 3 {
+			return nil, fmt.Errorf("unexpected CLUSTER SLOTS reply %v", r)
+		}
+		start, _ := redis.Int(slotRange[0], nil)
+		end, _ := redis.Int(slotRange[1], nil)
+		node, err := redis.Values(slotRange[2], nil)
+		if err != nil || len(node) < 2 {
+			return nil, fmt.Errorf("unexpected CLUSTER SLOTS node %v", slotRange[2])
+		}
+		ip, _ := redis.String(node[0], nil)
+		port, _ := redis.Int(node[1], nil)
+		if ip == "" {
+			// the node that answered
+			ip = host
+		}
+		master := net.JoinHostPort(ip, strconv.Itoa(port))
+		for s := start; s <= end && s < clusterSlots; s++ {
+			slots[s] = master
+		}
+	}
+	return slots, nil
+}
+
+// addresses returns the sorted addresses of the masters, c.mu has to be held.
+func (c *cluster) addresses() []string {
+	seen := make(map[string]struct{})
+	var addresses []string
+	for _, address := range c.slots {
+		if _, ok := seen[address]; !ok && address != "" {
+			seen[address] = struct{}{}
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func (c *cluster) pool(address string) *redis.Pool {
+	c.mu.RLock()
+	p, ok := c.pools[address]
+	c.mu.RUnlock()
+	if ok {
+		return p
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.pools[address]; ok {
+		return p
+	}
+	p = c.newPool(func() (redis.Conn, error) { return c.dial(address) })
+	c.pools[address] = p
+	return p
+}
+
+func (c *cluster) conn(ctx context.Context, key string) (redis.Conn, error) {
+	s := slot(key)
+	c.mu.RLock()
+	address := c.slots[s]
+	c.mu.RUnlock()
+
+	if address == "" {
+		if err := c.refresh(); err != nil {
+			return nil, err
+		}
+		c.mu.RLock()
+		address = c.slots[s]
+		c.mu.RUnlock()
+		if address == "" {
+			return nil, easykv.WrapError(easykv.ErrUnavailable, fmt.Errorf("hash slot %d isn't served", s))
+		}
+	}
+
+	conn, err := c.pool(address).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &clusterConn{Conn: conn, cluster: c}, nil
+}
+
+func (c *cluster) masters(ctx context.Context) ([]redis.Conn, error) {
+	c.mu.RLock()
+	addresses := c.addresses()
+	c.mu.RUnlock()
+
+	conns := make([]redis.Conn, 0, len(addresses))
+	for _, address := range addresses {
+		conn, err := c.pool(address).GetContext(ctx)
+		if err != nil {
+			closeAll(conns)
+			return nil, err
+		}
+		conns = append(conns, &clusterConn{Conn: conn, cluster: c})
+	}
+	return conns, nil
+}
+
+func (c *cluster) dialMasters() ([]redis.Conn, error) {
+	c.mu.RLock()
+	addresses := c.addresses()
+	c.mu.RUnlock()
+
+	conns := make([]redis.Conn, 0, len(addresses))
+	for _, address := range addresses {
+		conn, err := c.dial(address)
+		if err != nil {
+			closeAll(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+func (c *cluster) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.pools {
+		p.Close()
+	}
+	return nil
+}
+
+// clusterConn follows the MOVED and ASK redirections of the cluster,
+// a MOVED redirection reloads the slot map.
+//
+// Commands between WATCH or MULTI and EXEC, DISCARD or UNWATCH aren't redirected,
+// as they would run outside of the transaction on another connection.
+// Their redirection errors are returned, so the whole transaction can be retried, see isRedirection.
+type clusterConn struct {
+	redis.Conn
+	cluster *cluster
+	txn     bool
+}
+
+func (c *clusterConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(cmd, args...)
+	return c.redirect(cmd, reply, err, func(conn redis.Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	})
+}
+
+func (c *clusterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	reply, err := redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+	return c.redirect(cmd, reply, err, func(conn redis.Conn) (interface{}, error) {
+		return redis.DoWithTimeout(conn, timeout, cmd, args...)
+	})
+}
+
+func (c *clusterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *clusterConn) redirect(cmd string, reply interface{}, err error, retry func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	inTxn := c.txn
+	switch strings.ToUpper(cmd) {
+	case "WATCH", "MULTI":
+		inTxn, c.txn = true, true
+	case "EXEC", "DISCARD", "UNWATCH":
+		c.txn = false
+	}
+
+	// a key of a migrating slot is redirected to its owner and then asked on the target of the migration
+	for i := 0; i < maxRedirects; i++ {
+		kind, address, ok := redirection(err)
+		if !ok {
+			return reply, err
+		}
+		if kind == "MOVED" {
+			c.cluster.logger.Debug("slot moved", "address", address)
+			if err := c.cluster.refresh(); err != nil {
+				return nil, err
+			}
+		}
+		if inTxn {
+			return reply, err
+		}
+		reply, err = c.follow(kind, address, retry)
+	}
+	return reply, err
+}
+
+// follow runs retry on the node at address, an ASK redirection is announced with ASKING.
+func (c *clusterConn) follow(kind, address string, retry func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	conn := c.cluster.pool(address).Get()
+	defer conn.Close()
+	if kind == "ASK" {
+		if _, err := conn.Do("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return retry(conn)
+}
+
+// redirection parses the redirection errors MOVED <slot> <address> and ASK <slot> <address>.
+func redirection(err error) (kind, address string, ok bool) {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return "", "", false
+	}
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", "", false
+	}
+	return fields[0], fields[2], true
+}
+
+// isRedirection reports whether err is a MOVED or ASK redirection error.
+func isRedirection(err error) bool {
+	_, _, ok := redirection(err)
+	return ok
+}
+
+// slot returns the hash slot of key, only the hash tag between { and } is hashed if key has one.
+func slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum redis cluster uses for the hash slots.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func closeAll(conns []redis.Conn) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package redis
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("redis", open)
+}
+
+// open creates a client from an url like
+//
+//	redis://:password@127.0.0.1:6379,127.0.0.2:6379/0
+//	redis://127.0.0.1:26379,127.0.0.2:26379/0?sentinel=mymaster
+//	redis://127.0.0.1:7000,127.0.0.2:7000?cluster=true
+//
+// The path selects the database. The hosts are the sentinels if the sentinel parameter
+// names the master and the seed nodes if cluster is true.
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	q, err := easykv.Query(u, "sentinel", "cluster")
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := easykv.BoolParam(q, "cluster")
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []Option
+	if name := q.Get("sentinel"); name != "" {
+		opts = append(opts, WithSentinel(name))
+	}
+	if cluster {
+		opts = append(opts, WithCluster())
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis database %q: %w", db, err)
+		}
+		opts = append(opts, WithDatabase(n))
+	}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			opts = append(opts, WithPassword(password))
+		}
+	}
+
+	c, err := New(easykv.Hosts(u), opts...)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
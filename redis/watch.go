@@ -0,0 +1,169 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"github.com/garyburd/redigo/redis"
+)
+
+// healthInterval is the interval of the pings on a subscribed connection,
+// a connection that doesn't answer within two intervals is considered broken.
+const healthInterval = 30 * time.Second
+
+var patternReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+// WatchPrefix subscribes to the keyspace notifications of all keys below prefix
+// and returns when a key that matches WithKeys is changed.
+// The notifications have to be enabled with notify-keyspace-events on the server, see WithKeyspaceNotifications.
+// In a cluster every master is subscribed.
+// Redis has no revisions, the returned index is a counter of the client that increases with every change
+// and is greater than the WaitIndex. Changes between two watches are not reported.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
+	// in a cluster the notifications are only published on the master of the key
+	conns, err := c.topo.dialMasters()
+	if err != nil {
+		return options.WaitIndex, wrapError(err)
+	}
+	defer closeAll(conns)
+
+	channel := fmt.Sprintf("__keyspace@%d__:", c.db)
+	prefix = strings.TrimSuffix(prefix, "/*")
+	pattern := channel + patternReplacer.Replace(prefix) + "*"
+
+	subscriptions := make([]redis.PubSubConn, len(conns))
+	for i, conn := range conns {
+		c.checkNotifications(conn)
+		subscriptions[i] = redis.PubSubConn{Conn: conn}
+		if err := subscriptions[i].PSubscribe(pattern); err != nil {
+			return options.WaitIndex, wrapError(err)
+		}
+	}
+
+	// the subscriptions block the connections, so they are closed to cancel the watch
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(healthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				closeAll(conns)
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+				for _, psc := range subscriptions {
+					psc.Ping("")
+				}
+			}
+		}
+	}()
+
+	// nil is sent for a change that matches the keys
+	results := make(chan error, len(subscriptions))
+	for _, psc := range subscriptions {
+		go func() {
+			for {
+				switch v := psc.ReceiveWithTimeout(2 * healthInterval).(type) {
+				case redis.PMessage:
+					if matchKeys(strings.TrimPrefix(v.Channel, channel), options.Keys) {
+						results <- nil
+						return
+					}
+				case error:
+					results <- v
+					return
+				}
+			}
+		}()
+	}
+
+	if err := <-results; err != nil {
+		if ctx.Err() != nil {
+			return options.WaitIndex, easykv.ErrWatchCanceled
+		}
+		return options.WaitIndex, wrapError(err)
+	}
+	return c.nextIndex(options.WaitIndex), nil
+}
+
+// nextIndex returns a watch index that is greater than the last one and waitIndex.
+func (c *Client) nextIndex(waitIndex uint64) uint64 {
+	for {
+		last := atomic.LoadUint64(&c.watchIndex)
+		next := last + 1
+		if next <= waitIndex {
+			next = waitIndex + 1
+		}
+		if atomic.CompareAndSwapUint64(&c.watchIndex, last, next) {
+			return next
+		}
+	}
+}
+
+// checkNotifications reads notify-keyspace-events and enables the notifications if WithKeyspaceNotifications is set.
+// Servers that don't allow the CONFIG command are expected to be configured already.
+func (c *Client) checkNotifications(conn redis.Conn) {
+	reply, err := redis.Strings(conn.Do("CONFIG", "GET", "notify-keyspace-events"))
+	if err != nil || len(reply) != 2 {
+		c.logger.Debug("can't read notify-keyspace-events", "error", err)
+		return
+	}
+	flags := reply[1]
+	if notifies(flags) {
+		return
+	}
+	if !c.notifyConfig {
+		c.logger.Warn("keyspace notifications are disabled, watches won't fire", "notify-keyspace-events", flags)
+		return
+	}
+	if _, err := conn.Do("CONFIG", "SET", "notify-keyspace-events", flags+"KA"); err != nil {
+		c.logger.Warn("can't enable keyspace notifications", "error", err)
+		return
+	}
+	c.logger.Info("keyspace notifications enabled", "notify-keyspace-events", flags+"KA")
+}
+
+// notifies reports whether the notify-keyspace-events flags publish the keyspace events of all commands.
+func notifies(flags string) bool {
+	if !strings.Contains(flags, "K") {
+		return false
+	}
+	return strings.Contains(flags, "A") || (strings.Contains(flags, "g") && strings.Contains(flags, "$"))
+}
+
+// matchKeys reports whether key or one of its nested keys matches keys.
+// The notification of a hash, list or set is about the whole value, so it matches the keys below it.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) || strings.HasPrefix(k, key+"/") {
+			return true
+		}
+	}
+	return false
+}
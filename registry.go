@@ -0,0 +1,126 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Factory creates a ReadWatcher from a backend url.
+type Factory func(u *url.URL) (ReadWatcher, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend available to Open under the url scheme.
+// It is called from the init function of the backend packages
+// and panics if the scheme is registered twice or f is nil.
+func Register(scheme string, f Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if f == nil {
+		panic("easykv: Register factory is nil")
+	}
+	if _, dup := factories[scheme]; dup {
+		panic("easykv: Register called twice for scheme " + scheme)
+	}
+	factories[scheme] = f
+}
+
+// Schemes returns a sorted list of the registered url schemes.
+func Schemes() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Open returns a new client for the backend selected by the scheme of rawurl, e.g.
+//
+//	easykv.Open("etcdv3://127.0.0.1:2379,127.0.0.2:2379/myapp?tls-ca=/etc/ssl/ca.pem")
+//	easykv.Open("redis://:password@127.0.0.1:6379/0")
+//	easykv.Open("file:///etc/myapp/config.yml")
+//
+// Hosts, credentials and query parameters are mapped to the options of the backend,
+// see the documentation of the backend packages for the supported parameters.
+// The backend package has to be imported to register its scheme:
+//
+//	import _ "github.com/HeavyHorst/easykv/etcd"
+func Open(rawurl string) (ReadWatcher, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	factoriesMu.RLock()
+	f, ok := factories[u.Scheme]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q (forgotten import?)", ErrUnknownBackend, u.Scheme)
+	}
+	return f(u)
+}
+
+// Hosts returns the comma separated hosts of u.
+func Hosts(u *url.URL) []string {
+	if u.Host == "" {
+		return nil
+	}
+	return strings.Split(u.Host, ",")
+}
+
+// Query returns the query parameters of u.
+// An error is returned for every parameter that isn't one of known, so typos aren't ignored.
+func Query(u *url.URL, known ...string) (url.Values, error) {
+	q := u.Query()
+	var unknown []string
+	for name := range q {
+		if !contains(known, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown %s url parameters: %s", u.Scheme, strings.Join(unknown, ", "))
+	}
+	return q, nil
+}
+
+// BoolParam parses the boolean query parameter name, it is false if the parameter isn't set.
+func BoolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid url parameter %s=%q: %w", name, v, err)
+	}
+	return b, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
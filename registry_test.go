@@ -0,0 +1,74 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package easykv
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	. "gopkg.in/check.v1"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type FilterSuite struct{}
+
+var _ = Suite(&FilterSuite{})
+
+func (s *FilterSuite) TestOpen(t *C) {
+	var got *url.URL
+	Register("easykvtest", func(u *url.URL) (ReadWatcher, error) {
+		got = u
+		return nil, nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "easykvtest")
+		factoriesMu.Unlock()
+	}()
+
+	_, err := Open("easykvtest://user:pw@host1:1234,host2:1234/path?a=b")
+	t.Assert(err, IsNil)
+	t.Check(Hosts(got), DeepEquals, []string{"host1:1234", "host2:1234"})
+	t.Check(got.User.Username(), Equals, "user")
+	t.Check(got.Path, Equals, "/path")
+	t.Check(got.Query().Get("a"), Equals, "b")
+	t.Check(Schemes(), DeepEquals, []string{"easykvtest"})
+
+	t.Check(func() { Register("easykvtest", func(u *url.URL) (ReadWatcher, error) { return nil, nil }) }, PanicMatches, ".*twice.*")
+}
+
+func (s *FilterSuite) TestOpenUnknown(t *C) {
+	_, err := Open("unknown://host")
+	t.Check(errors.Is(err, ErrUnknownBackend), Equals, true)
+}
+
+func (s *FilterSuite) TestQuery(t *C) {
+	u, _ := url.Parse("easykvtest://host?tls=true&b=1&a=2")
+	_, err := Query(u, "tls")
+	t.Check(err, ErrorMatches, "unknown easykvtest url parameters: a, b")
+
+	q, err := Query(u, "tls", "a", "b")
+	t.Assert(err, IsNil)
+	tls, err := BoolParam(q, "tls")
+	t.Check(err, IsNil)
+	t.Check(tls, Equals, true)
+	missing, err := BoolParam(q, "missing")
+	t.Check(err, IsNil)
+	t.Check(missing, Equals, false)
+	_, err = BoolParam(q, "a")
+	t.Check(err, NotNil)
+}
+
+func (s *FilterSuite) TestHosts(t *C) {
+	u, _ := url.Parse("env://")
+	t.Check(Hosts(u), HasLen, 0)
+}
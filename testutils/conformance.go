@@ -0,0 +1,562 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package testutils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/HeavyHorst/easykv"
+	"gopkg.in/check.v1"
+)
+
+// ConformancePrefix is the prefix below which the ConformanceSuite stores its keys.
+const ConformancePrefix = "/conformance"
+
+// ConformanceData is stored in the backend before every test of the ConformanceSuite.
+var ConformanceData = map[string]string{
+	"/conformance/app/name":      "easykv",
+	"/conformance/app/port":      "8080",
+	"/conformance/database/url":  "db.example.com",
+	"/conformance/database/user": "Boris",
+}
+
+const (
+	// how long a watch gets to reach the backend before the keys are changed
+	watchSettle = 200 * time.Millisecond
+	// how long a watch has to stay quiet for changes it doesn't care about
+	watchQuiet = 500 * time.Millisecond
+	// how long a watch may take to report a change
+	watchTimeout = 5 * time.Second
+)
+
+// ConformanceSuite is a gocheck suite that verifies the easykv.ReadWatcher contract of a backend.
+// Register it with check.Suite in the tests of the backend:
+//
+//	var _ = check.Suite(&testutils.ConformanceSuite{
+//		New: func(t *check.C) easykv.ReadWatcher {
+//			c, err := New(...)
+//			t.Assert(err, check.IsNil)
+//			return c
+//		},
+//	})
+//
+// Before every test ConformanceData is stored with Seed.
+// Backends that implement easykv.Writer only need New, the other hooks default to the Writer methods
+// and everything below ConformancePrefix is deleted before and after every test.
+type ConformanceSuite struct {
+	// New returns the backend under test. It is required.
+	New func(t *check.C) easykv.ReadWatcher
+	// Seed stores data in the backend, it defaults to Set.
+	Seed func(t *check.C, rw easykv.ReadWatcher, data map[string]string)
+	// Set creates or updates a single key, it defaults to easykv.Writer.Set.
+	Set func(t *check.C, rw easykv.ReadWatcher, key, value string)
+	// Delete removes a single key, it defaults to easykv.Writer.Delete.
+	Delete func(t *check.C, rw easykv.ReadWatcher, key string)
+
+	// NoWatch expects WatchPrefix to return easykv.ErrWatchNotSupported.
+	NoWatch bool
+	// NoWaitIndex skips the test that resumes a watch with WithWaitIndex,
+	// for backends that keep no history of changes.
+	NoWaitIndex bool
+	// LooseKeys allows WatchPrefix to fire for changes of keys that don't match WithKeys.
+	LooseKeys bool
+	// InitialIndex is set for backends whose WatchPrefix returns the current index at once if the WaitIndex is 0.
+	InitialIndex bool
+	// SingleKeyTxn skips the test that commits changes of several keys in one easykv.Txn.
+	SingleKeyTxn bool
+	// NoTTL skips the test of easykv.TTLWriter, for backends whose TTLs need extra configuration.
+	NoTTL bool
+
+	rw      easykv.ReadWatcher
+	ctx     context.Context
+	cancel  context.CancelFunc
+	created []string
+}
+
+type watchResult struct {
+	index uint64
+	err   error
+}
+
+// SetUpTest creates the backend and stores ConformanceData.
+func (s *ConformanceSuite) SetUpTest(t *check.C) {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.created = nil
+	s.rw = s.New(t)
+	s.clean(t)
+
+	if s.Seed != nil {
+		s.Seed(t, s.rw, ConformanceData)
+		return
+	}
+	for k, v := range ConformanceData {
+		s.set(t, k, v)
+	}
+}
+
+// TearDownTest stops all watches, removes the keys and closes the backend.
+func (s *ConformanceSuite) TearDownTest(t *check.C) {
+	s.cancel()
+	if s.rw == nil {
+		return
+	}
+	s.clean(t)
+	s.rw.Close()
+	s.rw = nil
+}
+
+func (s *ConformanceSuite) clean(t *check.C) {
+	if w, ok := s.rw.(easykv.Writer); ok {
+		err := w.DeletePrefix(context.Background(), ConformancePrefix)
+		if !errors.Is(err, easykv.ErrKeyNotFound) {
+			t.Check(err, check.IsNil)
+		}
+		return
+	}
+	if s.Delete != nil {
+		for k := range ConformanceData {
+			s.Delete(t, s.rw, k)
+		}
+		for _, k := range s.created {
+			s.Delete(t, s.rw, k)
+		}
+	}
+}
+
+func (s *ConformanceSuite) canWrite() bool {
+	if s.Set != nil && s.Delete != nil {
+		return true
+	}
+	_, ok := s.rw.(easykv.Writer)
+	return ok
+}
+
+func (s *ConformanceSuite) set(t *check.C, key, value string) {
+	if _, ok := ConformanceData[key]; !ok {
+		s.created = append(s.created, key)
+	}
+	if s.Set != nil {
+		s.Set(t, s.rw, key, value)
+		return
+	}
+	w, ok := s.rw.(easykv.Writer)
+	if !ok {
+		t.Fatal("the backend doesn't implement easykv.Writer, the suite needs Seed and Set")
+	}
+	t.Assert(w.Set(context.Background(), key, value), check.IsNil)
+}
+
+func (s *ConformanceSuite) delete(t *check.C, key string) {
+	if s.Delete != nil {
+		s.Delete(t, s.rw, key)
+		return
+	}
+	w, ok := s.rw.(easykv.Writer)
+	if !ok {
+		t.Fatal("the backend doesn't implement easykv.Writer, the suite needs Delete")
+	}
+	t.Assert(w.Delete(context.Background(), key), check.IsNil)
+}
+
+func (s *ConformanceSuite) skipWatch(t *check.C) {
+	if s.NoWatch {
+		t.Skip("the backend doesn't support watches")
+	}
+	if !s.canWrite() {
+		t.Skip("the suite can't change keys of the backend")
+	}
+}
+
+// watch starts WatchPrefix for ConformancePrefix in the background.
+func (s *ConformanceSuite) watch(ctx context.Context, keys []string, waitIndex uint64) <-chan watchResult {
+	result := make(chan watchResult, 1)
+	go func() {
+		index, err := s.rw.WatchPrefix(ctx, ConformancePrefix, easykv.WithKeys(keys), easykv.WithWaitIndex(waitIndex))
+		result <- watchResult{index, err}
+	}()
+	return result
+}
+
+// startWatch starts a watch that waits for the next change and gives it time to reach the backend.
+func (s *ConformanceSuite) startWatch(t *check.C, keys []string) <-chan watchResult {
+	var waitIndex uint64
+	if s.InitialIndex {
+		waitIndex = s.fired(t, s.watch(s.ctx, keys, 0))
+	}
+	result := s.watch(s.ctx, keys, waitIndex)
+	time.Sleep(watchSettle)
+	return result
+}
+
+// fired expects the watch to report a change and returns its index.
+func (s *ConformanceSuite) fired(t *check.C, result <-chan watchResult) uint64 {
+	select {
+	case r := <-result:
+		t.Assert(r.err, check.IsNil)
+		return r.index
+	case <-time.After(watchTimeout):
+		t.Fatal("the watch didn't report the change")
+	}
+	return 0
+}
+
+// quiet expects the watch not to report anything.
+func (s *ConformanceSuite) quiet(t *check.C, result <-chan watchResult) {
+	select {
+	case r := <-result:
+		t.Fatalf("the watch reported a change of a key it doesn't watch (index %d, err %v)", r.index, r.err)
+	case <-time.After(watchQuiet):
+	}
+}
+
+// TestGetValuesPrefix verifies that only the keys below the requested prefix are returned.
+func (s *ConformanceSuite) TestGetValuesPrefix(t *check.C) {
+	m, err := s.rw.GetValues([]string{"/conformance/app"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/conformance/app/name": "easykv",
+		"/conformance/app/port": "8080",
+	})
+
+	m, err = s.rw.GetValues([]string{"/conformance/app", "/conformance/database/url"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/conformance/app/name":     "easykv",
+		"/conformance/app/port":     "8080",
+		"/conformance/database/url": "db.example.com",
+	})
+}
+
+// TestGetValuesRoot verifies that the root prefix "/" returns every key.
+func (s *ConformanceSuite) TestGetValuesRoot(t *check.C) {
+	m, err := s.rw.GetValues([]string{"/"})
+	t.Assert(err, check.IsNil)
+	for k, v := range ConformanceData {
+		t.Check(m[k], check.Equals, v, check.Commentf("key %s", k))
+	}
+}
+
+// TestGetValuesOverlapping verifies that overlapping prefixes return every key once.
+func (s *ConformanceSuite) TestGetValuesOverlapping(t *check.C) {
+	m, err := s.rw.GetValues([]string{"/conformance/app", ConformancePrefix, "/conformance/app/name"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, ConformanceData)
+}
+
+// TestGetValuesEmpty verifies that a prefix without keys returns no values.
+// Backends may return easykv.ErrKeyNotFound instead.
+func (s *ConformanceSuite) TestGetValuesEmpty(t *check.C) {
+	m, err := s.rw.GetValues([]string{"/conformance/missing"})
+	if err != nil {
+		t.Check(errors.Is(err, easykv.ErrKeyNotFound), check.Equals, true, check.Commentf("unexpected error: %v", err))
+		return
+	}
+	t.Check(m, check.HasLen, 0)
+}
+
+// TestCapabilities verifies that the reported capabilities are backed by their interfaces.
+func (s *ConformanceSuite) TestCapabilities(t *check.C) {
+	caps := easykv.CapabilitiesOf(s.rw)
+	t.Check(caps.Watch, check.Equals, !s.NoWatch)
+
+	// a reported feature has to be backed by its interface
+	_, ok := s.rw.(easykv.Writer)
+	t.Check(!caps.Write || ok, check.Equals, true, check.Commentf("write"))
+	_, ok = s.rw.(easykv.TTLWriter)
+	t.Check(!caps.TTL || ok, check.Equals, true, check.Commentf("ttl"))
+	_, ok = s.rw.(easykv.Txn)
+	t.Check(!caps.Transactions || ok, check.Equals, true, check.Commentf("transactions"))
+	_, ok = s.rw.(easykv.EntryReader)
+	t.Check(!caps.Revisions || ok, check.Equals, true, check.Commentf("revisions"))
+}
+
+// TestPing verifies that a reachable backend answers a Ping.
+func (s *ConformanceSuite) TestPing(t *check.C) {
+	p, ok := s.rw.(easykv.Pinger)
+	if !ok {
+		t.Skip("no easykv.Pinger")
+	}
+	t.Assert(p.Ping(s.ctx), check.IsNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	t.Check(p.Ping(ctx), check.NotNil)
+}
+
+// TestGetEntries verifies that GetEntries returns the sorted entries below the prefix
+// and that the revision of a key grows when it is changed.
+func (s *ConformanceSuite) TestGetEntries(t *check.C) {
+	er, ok := s.rw.(easykv.EntryReader)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.EntryReader")
+	}
+
+	entries, err := er.GetEntries(s.ctx, []string{"/conformance/app"})
+	t.Assert(err, check.IsNil)
+	t.Assert(entries, check.HasLen, 2)
+	t.Check(entries[0].Key, check.Equals, "/conformance/app/name")
+	t.Check(string(entries[0].Value), check.Equals, "easykv")
+	t.Check(entries[1].Key, check.Equals, "/conformance/app/port")
+	t.Check(string(entries[1].Value), check.Equals, "8080")
+	for _, e := range entries {
+		t.Check(e.Revision > 0, check.Equals, true)
+	}
+
+	if !s.canWrite() {
+		return
+	}
+	s.set(t, "/conformance/app/name", "changed")
+	changed, err := er.GetEntries(s.ctx, []string{"/conformance/app/name"})
+	t.Assert(err, check.IsNil)
+	t.Assert(changed, check.HasLen, 1)
+	t.Check(string(changed[0].Value), check.Equals, "changed")
+	t.Check(changed[0].Revision > entries[0].Revision, check.Equals, true)
+}
+
+// TestGetSnapshot verifies that GetSnapshot returns the values of all prefixes
+// and that the revision of the snapshot grows after a change.
+func (s *ConformanceSuite) TestGetSnapshot(t *check.C) {
+	sr, ok := s.rw.(easykv.SnapshotReader)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.SnapshotReader")
+	}
+
+	snap, err := sr.GetSnapshot(s.ctx, []string{"/conformance/app", "/conformance/database/url"})
+	t.Assert(err, check.IsNil)
+	t.Check(snap.Values, check.DeepEquals, map[string]string{
+		"/conformance/app/name":     "easykv",
+		"/conformance/app/port":     "8080",
+		"/conformance/database/url": "db.example.com",
+	})
+	t.Check(snap.Revision > 0, check.Equals, true)
+
+	if !s.canWrite() {
+		return
+	}
+	s.set(t, "/conformance/app/name", "changed")
+	changed, err := sr.GetSnapshot(s.ctx, []string{"/conformance/app/name"})
+	t.Assert(err, check.IsNil)
+	t.Check(changed.Values, check.DeepEquals, map[string]string{"/conformance/app/name": "changed"})
+	t.Check(changed.Revision > snap.Revision, check.Equals, true)
+}
+
+// revisions returns the revisions GetEntries reports for keys.
+func (s *ConformanceSuite) revisions(t *check.C, keys ...string) map[string]uint64 {
+	er, ok := s.rw.(easykv.EntryReader)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.EntryReader")
+	}
+	entries, err := er.GetEntries(s.ctx, keys)
+	t.Assert(err, check.IsNil)
+	revisions := make(map[string]uint64)
+	for _, e := range entries {
+		revisions[e.Key] = e.Revision
+	}
+	return revisions
+}
+
+// TestCompareAndSwap verifies that CompareAndSwap only sets a key whose revision matches,
+// revision 0 creates a key that must not exist.
+func (s *ConformanceSuite) TestCompareAndSwap(t *check.C) {
+	txn, ok := s.rw.(easykv.Txn)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.Txn")
+	}
+	rev := s.revisions(t, "/conformance/app/name")["/conformance/app/name"]
+
+	t.Assert(txn.CompareAndSwap(s.ctx, "/conformance/app/name", rev, "swapped"), check.IsNil)
+	err := txn.CompareAndSwap(s.ctx, "/conformance/app/name", rev, "stale")
+	t.Check(errors.Is(err, easykv.ErrConflict), check.Equals, true, check.Commentf("%v", err))
+
+	t.Assert(txn.CompareAndSwap(s.ctx, "/conformance/app/host", 0, "localhost"), check.IsNil)
+	err = txn.CompareAndSwap(s.ctx, "/conformance/app/host", 0, "example.com")
+	t.Check(errors.Is(err, easykv.ErrConflict), check.Equals, true, check.Commentf("%v", err))
+
+	m, err := s.rw.GetValues([]string{"/conformance/app"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/conformance/app/name": "swapped",
+		"/conformance/app/port": "8080",
+		"/conformance/app/host": "localhost",
+	})
+}
+
+// TestCommit verifies that Commit applies all operations if every compare matches and none otherwise.
+func (s *ConformanceSuite) TestCommit(t *check.C) {
+	txn, ok := s.rw.(easykv.Txn)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.Txn")
+	}
+	if s.SingleKeyTxn {
+		t.Skip("the backend can't change several keys in one transaction")
+	}
+	revs := s.revisions(t, "/conformance/app")
+
+	cmps := []easykv.Compare{
+		{Key: "/conformance/app/name", Revision: revs["/conformance/app/name"]},
+		{Key: "/conformance/app/port", Revision: revs["/conformance/app/port"]},
+		{Key: "/conformance/app/host", Revision: 0},
+	}
+	err := txn.Commit(s.ctx, cmps, []easykv.TxnOp{
+		easykv.PutOp("/conformance/app/name", "committed"),
+		easykv.DeleteOp("/conformance/app/port"),
+		easykv.PutOp("/conformance/app/host", "localhost"),
+	})
+	t.Assert(err, check.IsNil)
+
+	// all compares are stale now, nothing may be applied
+	err = txn.Commit(s.ctx, cmps, []easykv.TxnOp{
+		easykv.PutOp("/conformance/app/name", "stale"),
+		easykv.PutOp("/conformance/database/url", "stale"),
+	})
+	t.Check(errors.Is(err, easykv.ErrConflict), check.Equals, true, check.Commentf("%v", err))
+
+	m, err := s.rw.GetValues([]string{"/conformance"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/conformance/app/name":      "committed",
+		"/conformance/app/host":      "localhost",
+		"/conformance/database/url":  "db.example.com",
+		"/conformance/database/user": "Boris",
+	})
+}
+
+// TestSetWithTTL verifies that a key set with a ttl is kept while its lease is open and removed when the lease is closed.
+func (s *ConformanceSuite) TestSetWithTTL(t *check.C) {
+	tw, ok := s.rw.(easykv.TTLWriter)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.TTLWriter")
+	}
+	if s.NoTTL {
+		t.Skip("the backend needs extra configuration for TTLs")
+	}
+
+	// the ttl is long enough for every backend, the lease is closed long before
+	lease, err := tw.SetWithTTL(s.ctx, "/conformance/app/instance", "up", 15*time.Second)
+	t.Assert(err, check.IsNil)
+	m, err := s.rw.GetValues([]string{"/conformance/app/instance"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{"/conformance/app/instance": "up"})
+
+	select {
+	case <-lease.Done():
+		t.Fatal("the lease ended before it was closed")
+	default:
+	}
+
+	t.Assert(lease.Close(), check.IsNil)
+	select {
+	case <-lease.Done():
+	case <-time.After(watchTimeout):
+		t.Fatal("the lease didn't end after it was closed")
+	}
+	m, err = s.rw.GetValues([]string{"/conformance/app/instance"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.HasLen, 0)
+}
+
+// TestSetWithZeroTTL verifies that a ttl that isn't positive is rejected before the key is set.
+func (s *ConformanceSuite) TestSetWithZeroTTL(t *check.C) {
+	tw, ok := s.rw.(easykv.TTLWriter)
+	if !ok {
+		t.Skip("the backend doesn't implement easykv.TTLWriter")
+	}
+
+	_, err := tw.SetWithTTL(s.ctx, "/conformance/app/instance", "up", 0)
+	t.Check(errors.Is(err, easykv.ErrInvalid), check.Equals, true)
+	m, err := s.rw.GetValues([]string{"/conformance/app/instance"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.HasLen, 0)
+}
+
+// TestWatchCreate verifies that WatchPrefix fires if a key is created.
+func (s *ConformanceSuite) TestWatchCreate(t *check.C) {
+	s.skipWatch(t)
+	result := s.startWatch(t, []string{"/conformance/app"})
+	s.set(t, "/conformance/app/version", "1")
+	s.fired(t, result)
+}
+
+// TestWatchUpdate verifies that WatchPrefix fires if a key is updated.
+func (s *ConformanceSuite) TestWatchUpdate(t *check.C) {
+	s.skipWatch(t)
+	result := s.startWatch(t, []string{"/conformance/app"})
+	s.set(t, "/conformance/app/port", "8081")
+	s.fired(t, result)
+}
+
+// TestWatchDelete verifies that WatchPrefix fires if a key is deleted.
+func (s *ConformanceSuite) TestWatchDelete(t *check.C) {
+	s.skipWatch(t)
+	result := s.startWatch(t, []string{"/conformance/app"})
+	s.delete(t, "/conformance/app/port")
+	s.fired(t, result)
+}
+
+// TestWatchKeys verifies that WatchPrefix ignores changes of keys that don't match WithKeys.
+func (s *ConformanceSuite) TestWatchKeys(t *check.C) {
+	s.skipWatch(t)
+	result := s.startWatch(t, []string{"/conformance/app"})
+	if !s.LooseKeys {
+		s.set(t, "/conformance/database/url", "db2.example.com")
+		s.quiet(t, result)
+	}
+	s.set(t, "/conformance/app/name", "easykv2")
+	s.fired(t, result)
+}
+
+// TestWatchWaitIndex verifies that a change between two watches is reported
+// if the second watch resumes with the index returned by the first one.
+func (s *ConformanceSuite) TestWatchWaitIndex(t *check.C) {
+	s.skipWatch(t)
+	if s.NoWaitIndex {
+		t.Skip("the backend can't resume watches")
+	}
+	keys := []string{"/conformance/app"}
+	result := s.startWatch(t, keys)
+	s.set(t, "/conformance/app/name", "easykv2")
+	index := s.fired(t, result)
+
+	s.set(t, "/conformance/app/name", "easykv3")
+	next := s.fired(t, s.watch(s.ctx, keys, index))
+	t.Check(next, check.Not(check.Equals), index)
+}
+
+// TestWatchCancel verifies that a canceled watch returns easykv.ErrWatchCanceled.
+func (s *ConformanceSuite) TestWatchCancel(t *check.C) {
+	if s.NoWatch {
+		t.Skip("the backend doesn't support watches")
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	result := s.watch(ctx, []string{"/conformance/app"}, 0)
+	time.Sleep(watchSettle)
+	cancel()
+
+	select {
+	case r := <-result:
+		if s.InitialIndex && r.err == nil {
+			// the watch returned the current index before it was canceled
+			r = <-s.watch(ctx, []string{"/conformance/app"}, r.index)
+		}
+		t.Check(r.err, check.Equals, easykv.ErrWatchCanceled)
+	case <-time.After(watchTimeout):
+		t.Fatal("the watch didn't return after it was canceled")
+	}
+}
+
+// TestWatchNotSupported verifies that backends without watches return easykv.ErrWatchNotSupported.
+func (s *ConformanceSuite) TestWatchNotSupported(t *check.C) {
+	if !s.NoWatch {
+		t.Skip("the backend supports watches")
+	}
+	_, err := s.rw.WatchPrefix(s.ctx, ConformancePrefix, easykv.WithKeys([]string{ConformancePrefix}))
+	t.Check(err, check.Equals, easykv.ErrWatchNotSupported)
+}
@@ -0,0 +1,98 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package testutils
+
+import (
+	"context"
+	"time"
+
+	"github.com/HeavyHorst/easykv/lock"
+	"gopkg.in/check.v1"
+)
+
+// Locker is a util function to test the lock.Locker methods
+func Locker(t *check.C, l lock.Locker) {
+	ctx := context.Background()
+	first, err := l.Lock(ctx, "/locktest/mutex")
+	t.Assert(err, check.IsNil)
+
+	// a second contender blocks until the lock is released
+	tctx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+	_, err = l.Lock(tctx, "/locktest/mutex")
+	cancel()
+	t.Assert(err, check.NotNil)
+
+	acquired := make(chan lock.Lock, 1)
+	go func() {
+		second, err := l.Lock(ctx, "/locktest/mutex")
+		if err != nil {
+			close(acquired)
+			return
+		}
+		acquired <- second
+	}()
+
+	t.Assert(first.Unlock(ctx), check.IsNil)
+	select {
+	case <-first.Done():
+	case <-time.After(watchTimeout):
+		t.Fatal("the released lock isn't done")
+	}
+	select {
+	case second, ok := <-acquired:
+		t.Assert(ok, check.Equals, true)
+		t.Check(second.Unlock(ctx), check.IsNil)
+	case <-time.After(watchTimeout):
+		t.Fatal("the lock wasn't passed on")
+	}
+}
+
+// Elector is a util function to test the lock.Elector methods
+func Elector(t *check.C, e lock.Elector) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaders := e.Election("/locktest/election").Observe(ctx)
+	nextLeader := func() string {
+		select {
+		case leader := <-leaders:
+			return leader
+		case <-time.After(watchTimeout):
+			t.Fatal("no leader was observed")
+		}
+		return ""
+	}
+
+	a := e.Election("/locktest/election")
+	b := e.Election("/locktest/election")
+	t.Assert(a.Campaign(ctx, "a"), check.IsNil)
+	t.Check(nextLeader(), check.Equals, "a")
+
+	won := make(chan error, 1)
+	go func() { won <- b.Campaign(ctx, "b") }()
+	select {
+	case err := <-won:
+		t.Fatalf("a second leader was elected: %v", err)
+	case <-time.After(watchQuiet):
+	}
+
+	t.Assert(a.Resign(ctx), check.IsNil)
+	select {
+	case <-a.Done():
+	case <-time.After(watchTimeout):
+		t.Fatal("the resigned leadership isn't done")
+	}
+	select {
+	case err := <-won:
+		t.Assert(err, check.IsNil)
+	case <-time.After(watchTimeout):
+		t.Fatal("no new leader was elected")
+	}
+	t.Check(nextLeader(), check.Equals, "b")
+	t.Check(b.Resign(ctx), check.IsNil)
+}
@@ -10,6 +10,7 @@ package testutils
 
 import (
 	"context"
+	"time"
 
 	"github.com/HeavyHorst/easykv"
 	"gopkg.in/check.v1"
@@ -47,6 +48,18 @@ func GetValues(t *check.C, c easykv.ReadWatcher) error {
 	return nil
 }
 
+// GetValuesContext is a util function to test the easykv.ContextReader.GetValuesContext Method
+func GetValuesContext(t *check.C, c easykv.ContextReader) {
+	m, err := c.GetValuesContext(context.Background(), []string{"/premtest"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, expectedPrefix)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetValuesContext(ctx, []string{"/remtest", "/premtest"})
+	t.Check(err, check.NotNil)
+}
+
 // WatchPrefix is a util function to test the easykv.ReadWatcher.WatchPrefix Method
 func WatchPrefix(ctx context.Context, t *check.C, c easykv.ReadWatcher, prefix string, keys []string) uint64 {
 	n, err := c.WatchPrefix(ctx, prefix, easykv.WithWaitIndex(0), easykv.WithKeys(keys))
@@ -63,4 +76,99 @@ func WatchPrefixError(t *check.C, c easykv.ReadWatcher) {
 	num, err := c.WatchPrefix(context.Background(), "")
 	t.Check(num, check.Equals, uint64(0))
 	t.Check(err, check.Equals, easykv.ErrWatchNotSupported)
+	t.Check(easykv.CapabilitiesOf(c).Watch, check.Equals, false)
+}
+
+// Writer is a util function to test the easykv.Writer methods
+func Writer(t *check.C, c easykv.ReadWriteWatcher) {
+	ctx := context.Background()
+	t.Assert(c.Set(ctx, "/writetest/database/url", "www.google.de"), check.IsNil)
+	t.Assert(c.Set(ctx, "/writetest/database/user", "Boris"), check.IsNil)
+	t.Assert(c.Set(ctx, "/writetest/app/name", "easykv"), check.IsNil)
+
+	m, err := c.GetValues([]string{"/writetest"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/writetest/database/url":  "www.google.de",
+		"/writetest/database/user": "Boris",
+		"/writetest/app/name":      "easykv",
+	})
+
+	t.Assert(c.Set(ctx, "/writetest/database/user", "Jan"), check.IsNil)
+	t.Assert(c.Delete(ctx, "/writetest/database/url"), check.IsNil)
+	m, err = c.GetValues([]string{"/writetest"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/writetest/database/user": "Jan",
+		"/writetest/app/name":      "easykv",
+	})
+
+	t.Assert(c.DeletePrefix(ctx, "/writetest/database"), check.IsNil)
+	m, err = c.GetValues([]string{"/writetest"})
+	t.Assert(err, check.IsNil)
+	t.Check(m, check.DeepEquals, map[string]string{
+		"/writetest/app/name": "easykv",
+	})
+
+	t.Assert(c.DeletePrefix(ctx, "/writetest"), check.IsNil)
+	// some backends return an error if the prefix doesn't exist
+	m, err = c.GetValues([]string{"/writetest"})
+	if err == nil {
+		t.Check(m, check.HasLen, 0)
+	}
+}
+
+// EventReadWriter is implemented by backends that can write and stream changes
+type EventReadWriter interface {
+	easykv.EventWatcher
+	easykv.Writer
+}
+
+// Watch is a util function to test the easykv.EventWatcher.Watch Method
+func Watch(t *check.C, c EventReadWriter) {
+	bg := context.Background()
+	t.Assert(c.Set(bg, "/watchtest/app/name", "easykv"), check.IsNil)
+	defer c.DeletePrefix(bg, "/watchtest")
+
+	ctx, cancel := context.WithCancel(bg)
+	defer cancel()
+	events, err := c.Watch(ctx, "/watchtest", easykv.WithKeys([]string{"/watchtest/database"}))
+	t.Assert(err, check.IsNil)
+
+	next := func() easykv.Event {
+		select {
+		case e, ok := <-events:
+			t.Assert(ok, check.Equals, true)
+			t.Assert(e.Err, check.IsNil)
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+		return easykv.Event{}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	t.Assert(c.Set(bg, "/watchtest/app/version", "1"), check.IsNil)
+	t.Assert(c.Set(bg, "/watchtest/database/url", "www.google.de"), check.IsNil)
+	e := next()
+	t.Check(e.Key, check.Equals, "/watchtest/database/url")
+	t.Check(e.Value, check.Equals, "www.google.de")
+	t.Check(e.Type, check.Equals, easykv.EventPut)
+	t.Check(e.Revision > 0, check.Equals, true)
+
+	t.Assert(c.Set(bg, "/watchtest/database/url", "www.google.com"), check.IsNil)
+	e2 := next()
+	t.Check(e2.Key, check.Equals, "/watchtest/database/url")
+	t.Check(e2.Value, check.Equals, "www.google.com")
+	t.Check(e2.Type, check.Equals, easykv.EventPut)
+	t.Check(e2.Revision > e.Revision, check.Equals, true)
+
+	t.Assert(c.Delete(bg, "/watchtest/database/url"), check.IsNil)
+	e = next()
+	t.Check(e.Key, check.Equals, "/watchtest/database/url")
+	t.Check(e.Type, check.Equals, easykv.EventDelete)
+
+	cancel()
+	for range events {
+	}
 }
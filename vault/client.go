@@ -21,6 +21,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"path"
 
@@ -31,6 +32,7 @@ import (
 // Client is a wrapper around the vault client
 type Client struct {
 	client *vaultapi.Client
+	logger *slog.Logger
 }
 
 // get a parameter from a map, panics if no value was found
@@ -182,10 +184,13 @@ func New(address, authType string, opts ...Option) (*Client, error) {
 		return nil, err
 	}
 
+	logger := easykv.BackendLogger(options.Logger, "vault")
 	if err := authenticate(c, authType, params); err != nil {
-		return nil, err
+		logger.Error("authentication failed", "address", address, "auth", authType, "error", err)
+		return nil, wrapError(err)
 	}
-	return &Client{c}, nil
+	logger.Debug("authenticated", "address", address, "auth", authType)
+	return &Client{c, logger}, nil
 }
 
 // Close is only meant to fulfill the easykv.ReadWatcher interface.
@@ -195,18 +200,26 @@ func (c *Client) Close() {}
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues but the requests are bound to ctx.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	branches := make(map[string]bool)
 
 	for _, key := range keys {
-		walkTree(c.client, key, branches)
+		walkTree(ctx, c.client, key, branches)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, wrapError(err)
 	}
 
 	vars := make(map[string]string)
 	for key := range branches {
-		resp, err := c.client.Logical().Read(key)
+		resp, err := c.client.Logical().ReadWithContext(ctx, key)
 
 		if err != nil {
-			return nil, err
+			return nil, wrapError(err)
 		}
 		if resp == nil || resp.Data == nil {
 			continue
@@ -229,7 +242,7 @@ func (c *Client) GetValues(keys []string) (map[string]string, error) {
 }
 
 // recursively walk the branches in the Vault, adding to branches map
-func walkTree(c *vaultapi.Client, key string, branches map[string]bool) error {
+func walkTree(ctx context.Context, c *vaultapi.Client, key string, branches map[string]bool) error {
 	// strip trailing slash as long as it's not the only character
 	if last := len(key) - 1; last > 0 && key[last] == '/' {
 		key = key[:last]
@@ -241,9 +254,9 @@ func walkTree(c *vaultapi.Client, key string, branches map[string]bool) error {
 	}
 	branches[key] = true
 
-	resp, err := c.Logical().List(key)
+	resp, err := c.Logical().ListWithContext(ctx, key)
 	if err != nil {
-		return err
+		return wrapError(err)
 	}
 	if resp == nil || resp.Data == nil || resp.Data["keys"] == nil {
 		return nil
@@ -261,7 +274,7 @@ func walkTree(c *vaultapi.Client, key string, branches map[string]bool) error {
 		switch innerKey := innerKey.(type) {
 		case string:
 			innerKey = path.Join(key, "/", innerKey)
-			walkTree(c, innerKey, branches)
+			walkTree(ctx, c, innerKey, branches)
 		}
 	}
 	return nil
@@ -297,3 +310,20 @@ func flatten(key string, value interface{}, vars map[string]string) {
 func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
 	return 0, easykv.ErrWatchNotSupported
 }
+
+// Capabilities reports that vault is read-only and can't be watched.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{}
+}
+
+// Ping checks the health of vault, a sealed or uninitialized vault is unavailable.
+func (c *Client) Ping(ctx context.Context) error {
+	health, err := c.client.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return wrapError(err)
+	}
+	if !health.Initialized || health.Sealed {
+		return easykv.WrapError(easykv.ErrUnavailable, errors.New("vault is sealed or not initialized"))
+	}
+	return nil
+}
@@ -59,6 +59,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	c.client.Logical().Write("/remtest/database/hosts/1", map[string]interface{}{"name": "test2", "ip": "192.168.0.2", "size": "80"})
 
 	testutils.GetValues(t, c)
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestGetParameterEmptyMap(t *C) {
@@ -0,0 +1,35 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package vault
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/HeavyHorst/easykv"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// wrapError marks the errors of the vault api with the easykv error kinds.
+func wrapError(err error) error {
+	var respErr *vaultapi.ResponseError
+	if errors.As(err, &respErr) {
+		switch {
+		case respErr.StatusCode == http.StatusUnauthorized, respErr.StatusCode == http.StatusForbidden:
+			return easykv.WrapError(easykv.ErrUnauthorized, err)
+		case respErr.StatusCode == http.StatusNotFound:
+			return easykv.WrapError(easykv.ErrKeyNotFound, err)
+		case respErr.StatusCode >= http.StatusInternalServerError:
+			// a sealed vault or a standby without an active node answers with 503
+			return easykv.WrapError(easykv.ErrUnavailable, err)
+		}
+		return err
+	}
+	return easykv.ClassifyError(err)
+}
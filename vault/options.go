@@ -8,6 +8,8 @@
 
 package vault
 
+import "log/slog"
+
 // Options contains all values that are needed to connect to vault.
 type Options struct {
 	RoleID   string
@@ -17,6 +19,7 @@ type Options struct {
 	Token    string
 	TLS      TLSOptions
 	Auth     BasicAuthOptions
+	Logger   *slog.Logger
 }
 
 // BasicAuthOptions contains options regarding to basic authentication.
@@ -83,3 +86,10 @@ func WithBasicAuth(b BasicAuthOptions) Option {
 		o.Auth = b
 	}
 }
+
+// WithLogger sets the logger for the authentication, records are discarded by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
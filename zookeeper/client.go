@@ -17,7 +17,12 @@ package zookeeper
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -29,16 +34,28 @@ import (
 // Client provides a wrapper around the zookeeper client
 type Client struct {
 	client *zk.Conn
+	logger *slog.Logger
 }
 
 // New returns an *zookeeper.Client with a connection to named machines.
 // It returns an error if a connection to the cluster cannot be made.
-func New(machines []string) (*Client, error) {
-	c, _, err := zk.Connect(machines, time.Second)
+func New(machines []string, opts ...Option) (*Client, error) {
+	var options Options
+	for _, o := range opts {
+		o(&options)
+	}
+	logger := easykv.BackendLogger(options.Logger, "zookeeper")
+
+	// the zookeeper library keeps its default logger unless a logger is given
+	setLogger := func(c *zk.Conn) {}
+	if options.Logger != nil {
+		setLogger = func(c *zk.Conn) { c.SetLogger(zkLogger{logger}) }
+	}
+	c, _, err := zk.Connect(machines, time.Second, setLogger)
 	if err != nil {
 		panic(err)
 	}
-	return &Client{c}, nil
+	return &Client{c, logger}, nil
 }
 
 // Close closes the zookeper client connection.
@@ -48,18 +65,23 @@ func (c *Client) Close() {
 	}
 }
 
-func nodeWalk(prefix string, c *Client, vars map[string]string) error {
+// nodeWalk recursively descends the nodes below prefix and calls fn for every leaf.
+func nodeWalk(ctx context.Context, prefix string, c *Client, fn func(key string, data []byte, stat *zk.Stat)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	l, stat, err := c.client.Children(prefix)
 	if err != nil {
 		return err
 	}
 
 	if stat.NumChildren == 0 {
-		b, _, err := c.client.Get(prefix)
+		b, stat, err := c.client.Get(prefix)
 		if err != nil {
 			return err
 		}
-		vars[prefix] = string(b)
+		fn(prefix, b, stat)
 
 	} else {
 		for _, key := range l {
@@ -69,13 +91,13 @@ func nodeWalk(prefix string, c *Client, vars map[string]string) error {
 				return err
 			}
 			if stat.NumChildren == 0 {
-				b, _, err := c.client.Get(s)
+				b, stat, err := c.client.Get(s)
 				if err != nil {
 					return err
 				}
-				vars[s] = string(b)
+				fn(s, b, stat)
 			} else {
-				nodeWalk(s, c, vars)
+				nodeWalk(ctx, s, c, fn)
 			}
 		}
 	}
@@ -85,48 +107,386 @@ func nodeWalk(prefix string, c *Client, vars map[string]string) error {
 // GetValues is used to lookup all keys with a prefix.
 // Several prefixes can be specified in the keys array.
 func (c *Client) GetValues(keys []string) (map[string]string, error) {
+	return c.GetValuesContext(context.Background(), keys)
+}
+
+// GetValuesContext is like GetValues.
+// The zookeeper client can't cancel single requests, so ctx is checked between them.
+func (c *Client) GetValuesContext(ctx context.Context, keys []string) (map[string]string, error) {
 	vars := make(map[string]string)
 	for _, v := range keys {
 		v = strings.Replace(v, "/*", "", -1)
 		_, _, err := c.client.Exists(v)
 		if err != nil {
-			return vars, err
+			return vars, wrapError(err)
 		}
 		if v == "/" {
 			v = ""
 		}
-		err = nodeWalk(v, c, vars)
+		err = nodeWalk(ctx, v, c, func(key string, data []byte, stat *zk.Stat) {
+			vars[key] = string(data)
+		})
 		if err != nil {
-			return vars, err
+			return vars, wrapError(err)
 		}
 	}
 	return vars, nil
 }
 
+// GetEntries returns the entries of all keys with one of the prefixes in keys.
+// The revisions are zxids, ephemeral nodes have the session id of their owner as Lease.
+func (c *Client) GetEntries(ctx context.Context, keys []string) ([]easykv.Entry, error) {
+	entries := make(map[string]easykv.Entry)
+	for _, v := range keys {
+		v = strings.Replace(v, "/*", "", -1)
+		if v == "/" {
+			v = ""
+		}
+		err := nodeWalk(ctx, v, c, func(key string, data []byte, stat *zk.Stat) {
+			e := easykv.Entry{
+				Key:            key,
+				Value:          data,
+				Revision:       uint64(stat.Mzxid),
+				CreateRevision: uint64(stat.Czxid),
+				Version:        uint64(stat.Version) + 1,
+				ModifyTime:     time.Unix(0, stat.Mtime*int64(time.Millisecond)),
+			}
+			if stat.EphemeralOwner != 0 {
+				e.Lease = strconv.FormatInt(stat.EphemeralOwner, 16)
+			}
+			entries[key] = e
+		})
+		if err != nil {
+			return nil, wrapError(err)
+		}
+	}
+
+	list := make([]easykv.Entry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	return list, nil
+}
+
+// Set sets the value of key.
+// Missing parent nodes are created with an empty value.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	if err := c.createParents(ctx, key); err != nil {
+		return wrapError(err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return wrapError(err)
+	}
+	_, err := c.client.Set(key, []byte(value), -1)
+	if err == zk.ErrNoNode {
+		if err := ctx.Err(); err != nil {
+			return wrapError(err)
+		}
+		_, err = c.client.Create(key, []byte(value), int32(0), zk.WorldACL(zk.PermAll))
+	}
+	return wrapError(err)
+}
+
+// createParents creates the missing parent nodes of key with an empty value.
+// The zookeeper client takes no context, ctx is checked before every request.
+func (c *Client) createParents(ctx context.Context, key string) error {
+	parts := strings.Split(strings.Trim(key, "/"), "/")
+	parent := ""
+	for _, part := range parts[:len(parts)-1] {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		parent += "/" + part
+		_, err := c.client.Create(parent, []byte(""), int32(0), zk.WorldACL(zk.PermAll))
+		if err != nil && err != zk.ErrNodeExists {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetWithTTL creates key as an ephemeral node, which is removed by the server when the session of the client ends.
+// The ttl is ignored, the session timeout of the client applies instead. An existing node is replaced.
+// The lease ends when the node is removed, closing it removes the node.
+func (c *Client) SetWithTTL(ctx context.Context, key, value string, ttl time.Duration) (easykv.Lease, error) {
+	if err := easykv.CheckTTL(ttl); err != nil {
+		return nil, err
+	}
+	if err := c.createParents(ctx, key); err != nil {
+		return nil, wrapError(err)
+	}
+	if err := c.client.Delete(key, -1); err != nil && err != zk.ErrNoNode {
+		return nil, wrapError(err)
+	}
+	if _, err := c.client.Create(key, []byte(value), zk.FlagEphemeral, zk.WorldACL(zk.PermAll)); err != nil {
+		return nil, wrapError(err)
+	}
+	_, stat, err := c.client.Exists(key)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	l := &lease{
+		c:     c,
+		key:   key,
+		czxid: stat.Czxid,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go l.watch()
+	return l, nil
+}
+
+// lease is an ephemeral node, identified by its Czxid.
+type lease struct {
+	c     *Client
+	key   string
+	czxid int64
+	stop  chan struct{}
+	done  chan struct{}
+
+	once sync.Once
+	err  error
+}
+
+// watch closes l.done when the node is removed.
+func (l *lease) watch() {
+	defer close(l.done)
+	for {
+		exists, stat, w, err := l.c.client.ExistsW(l.key)
+		var events <-chan zk.Event
+		var retry <-chan time.Time
+		switch {
+		case err == zk.ErrSessionExpired || err == zk.ErrClosing:
+			return
+		case err != nil:
+			// wait for the reconnect
+			retry = time.After(time.Second)
+		case !exists || stat.Czxid != l.czxid:
+			l.c.client.RemoveWatcher(w)
+			return
+		default:
+			events = w.EvtCh
+		}
+
+		select {
+		case <-events:
+		case <-retry:
+		case <-l.stop:
+			if w != nil {
+				l.c.client.RemoveWatcher(w)
+			}
+			return
+		}
+	}
+}
+
+func (l *lease) Done() <-chan struct{} {
+	return l.done
+}
+
+func (l *lease) Close() error {
+	l.once.Do(func() {
+		close(l.stop)
+		<-l.done
+		exists, stat, err := l.c.client.Exists(l.key)
+		if err != nil || !exists || stat.Czxid != l.czxid {
+			l.err = wrapError(err)
+			return
+		}
+		if err := l.c.client.Delete(l.key, stat.Version); err != nil && err != zk.ErrNoNode {
+			l.err = wrapError(err)
+		}
+	})
+	return l.err
+}
+
+// CompareAndSwap sets the value of key if its Mzxid is still revision.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string) error {
+	return c.Commit(ctx, []easykv.Compare{{Key: key, Revision: revision}}, []easykv.TxnOp{easykv.PutOp(key, value)})
+}
+
+// Commit applies all ops in one multi request if the Mzxids of all cmps match.
+// The Mzxids are compared before the request, the request itself checks that the versions
+// of the compared nodes are unchanged. Keys that must not exist are created and deleted again in the request.
+// Missing parent nodes are created with an empty value.
+func (c *Client) Commit(ctx context.Context, cmps []easykv.Compare, ops []easykv.TxnOp) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var reqs []interface{}
+	var paths []string // the key of every request, to report conflicts
+	add := func(key string, req interface{}) {
+		reqs = append(reqs, req)
+		paths = append(paths, key)
+	}
+
+	absent := make(map[string]bool)
+	for _, cmp := range cmps {
+		exists, stat, err := c.client.Exists(cmp.Key)
+		if err != nil {
+			return wrapError(err)
+		}
+		if cmp.Revision == 0 {
+			if exists {
+				return &easykv.ConflictError{Key: cmp.Key}
+			}
+			absent[cmp.Key] = true
+			continue
+		}
+		if !exists || uint64(stat.Mzxid) != cmp.Revision {
+			return &easykv.ConflictError{Key: cmp.Key}
+		}
+		add(cmp.Key, &zk.CheckVersionRequest{Path: cmp.Key, Version: stat.Version})
+	}
+
+	// existence of the keys after the requests so far
+	state := make(map[string]bool)
+	for key := range absent {
+		state[key] = false
+	}
+	for _, op := range ops {
+		exists, ok := state[op.Key]
+		if !ok {
+			var err error
+			if exists, _, err = c.client.Exists(op.Key); err != nil {
+				return wrapError(err)
+			}
+		}
+
+		switch {
+		case op.Delete && exists:
+			add(op.Key, &zk.DeleteRequest{Path: op.Key, Version: -1})
+		case op.Delete:
+		case exists:
+			add(op.Key, &zk.SetDataRequest{Path: op.Key, Data: []byte(op.Value), Version: -1})
+		default:
+			if err := c.createParents(ctx, op.Key); err != nil {
+				return wrapError(err)
+			}
+			// the create fails if the key exists, which checks absent keys as well
+			add(op.Key, &zk.CreateRequest{Path: op.Key, Data: []byte(op.Value), Acl: zk.WorldACL(zk.PermAll)})
+			delete(absent, op.Key)
+		}
+		state[op.Key] = !op.Delete
+	}
+
+	for key := range absent {
+		if err := c.createParents(ctx, key); err != nil {
+			return wrapError(err)
+		}
+		add(key, &zk.CreateRequest{Path: key, Acl: zk.WorldACL(zk.PermAll)})
+		add(key, &zk.DeleteRequest{Path: key, Version: -1})
+	}
+
+	if len(reqs) == 0 {
+		return nil
+	}
+	resp, err := c.client.Multi(reqs...)
+	if err == nil {
+		return nil
+	}
+	for i, r := range resp {
+		if i < len(paths) && (r.Error == zk.ErrBadVersion || r.Error == zk.ErrNodeExists || r.Error == zk.ErrNoNode) {
+			return &easykv.ConflictError{Key: paths[i]}
+		}
+	}
+	return wrapError(err)
+}
+
+// Delete removes key.
+// Nodes with children can't be deleted, use DeletePrefix instead.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return wrapError(err)
+	}
+	return wrapError(c.client.Delete(key, -1))
+}
+
+// DeletePrefix removes the node prefix and all nodes below it.
+func (c *Client) DeletePrefix(ctx context.Context, prefix string) error {
+	return wrapError(c.deleteTree(ctx, strings.Replace(prefix, "/*", "", -1)))
+}
+
+func (c *Client) deleteTree(ctx context.Context, node string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	children, _, err := c.client.Children(node)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, child := range children {
+		child = path.Join(node, child)
+		// the /zookeeper node is reserved by the server
+		if child == "/zookeeper" {
+			continue
+		}
+		if err := c.deleteTree(ctx, child); err != nil {
+			return err
+		}
+	}
+
+	if node == "/" {
+		return nil
+	}
+	err = c.client.Delete(node, -1)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	return err
+}
+
 type watchResponse struct {
 	waitIndex uint64
 	err       error
 }
 
-func (c *Client) watch(ctx context.Context, key string, respChan chan watchResponse) {
-	_, _, keyWatcher, err := c.client.GetW(key)
+// watch reports the next change of the data or the children of key to respChan.
+// A change after waitIndex that happened before the watches were set is reported at once.
+func (c *Client) watch(ctx context.Context, key string, waitIndex uint64, respChan chan watchResponse) {
+	send := func(r watchResponse) {
+		select {
+		case respChan <- r:
+		case <-ctx.Done():
+		}
+	}
+
+	_, stat, keyWatcher, err := c.client.GetW(key)
 	if err != nil {
-		respChan <- watchResponse{0, err}
+		send(watchResponse{0, err})
+		return
 	}
 	_, _, childWatcher, err := c.client.ChildrenW(key)
 	if err != nil {
-		respChan <- watchResponse{0, err}
+		c.client.RemoveWatcher(keyWatcher)
+		send(watchResponse{0, err})
+		return
+	}
+	if waitIndex > 0 && zxid(stat) > waitIndex {
+		c.client.RemoveWatcher(childWatcher)
+		c.client.RemoveWatcher(keyWatcher)
+		send(watchResponse{zxid(stat), nil})
+		return
 	}
 
 	for {
 		select {
 		case e := <-keyWatcher.EvtCh:
 			if e.Type == zk.EventNodeDataChanged {
-				respChan <- watchResponse{1, e.Err}
+				send(watchResponse{c.zxid(key), e.Err})
 			}
 		case e := <-childWatcher.EvtCh:
 			if e.Type == zk.EventNodeChildrenChanged {
-				respChan <- watchResponse{1, e.Err}
+				send(watchResponse{c.zxid(key), e.Err})
 			}
 		case <-ctx.Done():
 			c.client.RemoveWatcher(childWatcher)
@@ -136,13 +496,37 @@ func (c *Client) watch(ctx context.Context, key string, respChan chan watchRespo
 	}
 }
 
-// WatchPrefix watches a specific prefix for changes.
-func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (uint64, error) {
+// zxid returns the zxid of the last change of the data or the children of a node.
+func zxid(stat *zk.Stat) uint64 {
+	if stat == nil {
+		return 0
+	}
+	return uint64(max(stat.Mzxid, stat.Pzxid))
+}
+
+// zxid returns the zxid of the last change of key, or 1 if key was deleted in between.
+// The deletion is reported by the watch of the parent.
+func (c *Client) zxid(key string) uint64 {
+	_, stat, err := c.client.Exists(key)
+	if index := zxid(stat); err == nil && index > 0 {
+		return index
+	}
+	return 1
+}
+
+// WatchPrefix watches a specific prefix for changes and returns the zxid of the change.
+// WithWaitIndex resumes the watch after the given zxid, a node that was changed since is reported at once.
+// If no keys are given, every key below prefix is watched.
+// It returns easykv.ErrWatchCanceled if ctx is done, like the other backends.
+func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.WatchOption) (index uint64, err error) {
 	var options easykv.WatchOptions
 	for _, o := range opts {
 		o(&options)
 	}
 
+	c.logger.Debug("watch started", "prefix", prefix, "index", options.WaitIndex)
+	defer func() { easykv.LogWatch(c.logger, prefix, index, err) }()
+
 	// List the childrens first
 	entries, err := c.GetValues([]string{prefix})
 	if err != nil {
@@ -157,34 +541,29 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 	//watch all subfolders for changes
 	watchMap := make(map[string]struct{})
 	for k := range entries {
-		for _, v := range options.Keys {
-			if strings.HasPrefix(k, v) {
-				for dir := filepath.Dir(k); dir != "/"; dir = filepath.Dir(dir) {
-					if _, ok := watchMap[dir]; !ok {
-						watchMap[dir] = struct{}{}
-						wg.Add(1)
-						go func(dir string) {
-							defer wg.Done()
-							c.watch(ctx, dir, respChan)
-						}(dir)
-					}
-				}
-				break
+		if !matchKeys(k, options.Keys) {
+			continue
+		}
+		for dir := filepath.Dir(k); dir != "/"; dir = filepath.Dir(dir) {
+			if _, ok := watchMap[dir]; !ok {
+				watchMap[dir] = struct{}{}
+				wg.Add(1)
+				go func(dir string) {
+					defer wg.Done()
+					c.watch(ctx, dir, options.WaitIndex, respChan)
+				}(dir)
 			}
 		}
 	}
 
 	//watch all keys in prefix for changes
 	for k := range entries {
-		for _, v := range options.Keys {
-			if strings.HasPrefix(k, v) {
-				wg.Add(1)
-				go func(k string) {
-					defer wg.Done()
-					c.watch(ctx, k, respChan)
-				}(k)
-				break
-			}
+		if matchKeys(k, options.Keys) {
+			wg.Add(1)
+			go func(k string) {
+				defer wg.Done()
+				c.watch(ctx, k, options.WaitIndex, respChan)
+			}(k)
 		}
 	}
 
@@ -192,7 +571,7 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 		select {
 		case <-ctx.Done():
 			wg.Wait()
-			return options.WaitIndex, nil
+			return options.WaitIndex, easykv.ErrWatchCanceled
 		case r := <-respChan:
 			cancel()
 			go func() {
@@ -201,7 +580,38 @@ func (c *Client) WatchPrefix(ctx context.Context, prefix string, opts ...easykv.
 			}()
 			wg.Wait()
 			close(respChan)
-			return r.waitIndex, r.err
+			return r.waitIndex, wrapError(r.err)
 		}
 	}
 }
+
+// matchKeys reports whether key starts with one of keys.
+// An empty keys slice matches every key.
+func matchKeys(key string, keys []string) bool {
+	if len(keys) == 0 {
+		return true
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities reports the features of zookeeper.
+func (c *Client) Capabilities() easykv.Capabilities {
+	return easykv.Capabilities{Watch: true, Write: true, TTL: true, Transactions: true, Revisions: true, BinaryValues: true}
+}
+
+// Ping checks that the client has a session and reads the root node.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if state := c.client.State(); state != zk.StateHasSession {
+		return easykv.WrapError(easykv.ErrUnavailable, fmt.Errorf("zookeeper: %s", state))
+	}
+	_, _, err := c.client.Exists("/")
+	return wrapError(err)
+}
@@ -14,6 +14,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/HeavyHorst/easykv"
 	"github.com/HeavyHorst/easykv/testutils"
 	"github.com/tevino/go-zookeeper/zk"
 
@@ -27,6 +28,14 @@ type FilterSuite struct{}
 
 var _ = Suite(&FilterSuite{})
 
+var _ = Suite(&testutils.ConformanceSuite{
+	New: func(t *C) easykv.ReadWatcher {
+		c, err := New([]string{"127.0.0.1"})
+		t.Assert(err, IsNil)
+		return c
+	},
+})
+
 func (s *FilterSuite) TestGetValues(t *C) {
 	c, err := New([]string{"127.0.0.1"})
 	if err != nil {
@@ -55,6 +64,7 @@ func (s *FilterSuite) TestGetValues(t *C) {
 	if err != nil {
 		t.Error(err)
 	}
+	testutils.GetValuesContext(t, c)
 }
 
 func (s *FilterSuite) TestWatchPrefix(t *C) {
@@ -95,3 +105,89 @@ func (s *FilterSuite) TestWatchPrefixCancel(t *C) {
 	cancel()
 	wg.Wait()
 }
+
+func (s *FilterSuite) TestWriter(t *C) {
+	c, err := New([]string{"127.0.0.1"})
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Writer(t, c)
+}
+
+func (s *FilterSuite) TestWatch(t *C) {
+	c, err := New([]string{"127.0.0.1"})
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Watch(t, c)
+}
+
+func (s *FilterSuite) TestWatchMissingPrefix(t *C) {
+	c, err := New([]string{"127.0.0.1"})
+	t.Assert(err, IsNil)
+	defer c.Close()
+	bg := context.Background()
+	c.DeletePrefix(bg, "/watchmissing")
+
+	ctx, cancel := context.WithCancel(bg)
+	defer cancel()
+	events, err := c.Watch(ctx, "/watchmissing")
+	t.Assert(err, IsNil)
+
+	next := func() easykv.Event {
+		select {
+		case e := <-events:
+			t.Assert(e.Err, IsNil)
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+		return easykv.Event{}
+	}
+
+	// the prefix is created after the watch started
+	t.Assert(c.Set(bg, "/watchmissing/app/name", "easykv"), IsNil)
+	e := next()
+	t.Check(e.Key, Equals, "/watchmissing/app/name")
+	t.Check(e.Type, Equals, easykv.EventPut)
+
+	// the whole tree is removed, the parent of the deleted key is gone as well
+	t.Assert(c.DeletePrefix(bg, "/watchmissing"), IsNil)
+	e = next()
+	t.Check(e.Key, Equals, "/watchmissing/app/name")
+	t.Check(e.Type, Equals, easykv.EventDelete)
+	t.Check(e.Revision > 0, Equals, true)
+
+	// and created again, after the deletes of the emptied parents
+	t.Assert(c.Set(bg, "/watchmissing", "root"), IsNil)
+	for e = next(); e.Type == easykv.EventDelete; e = next() {
+		t.Check(e.Revision > 0, Equals, true)
+	}
+	t.Check(e.Key, Equals, "/watchmissing")
+	t.Check(e.Value, Equals, "root")
+	c.DeletePrefix(bg, "/watchmissing")
+}
+
+func (s *FilterSuite) TestLock(t *C) {
+	c, err := New([]string{"127.0.0.1"})
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Locker(t, c)
+}
+
+func (s *FilterSuite) TestElection(t *C) {
+	c, err := New([]string{"127.0.0.1"})
+	if err != nil {
+		t.Error(err)
+	}
+	defer c.Close()
+
+	testutils.Elector(t, c)
+}
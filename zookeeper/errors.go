@@ -0,0 +1,27 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package zookeeper
+
+import (
+	"github.com/HeavyHorst/easykv"
+	zk "github.com/tevino/go-zookeeper/zk"
+)
+
+// wrapError marks the errors of the zookeeper client with the easykv error kinds.
+func wrapError(err error) error {
+	switch err {
+	case zk.ErrNoNode:
+		return easykv.WrapError(easykv.ErrKeyNotFound, err)
+	case zk.ErrNoAuth, zk.ErrAuthFailed:
+		return easykv.WrapError(easykv.ErrUnauthorized, err)
+	case zk.ErrConnectionClosed, zk.ErrSessionExpired, zk.ErrClosing, zk.ErrNoServer:
+		return easykv.WrapError(easykv.ErrUnavailable, err)
+	}
+	return easykv.ClassifyError(err)
+}
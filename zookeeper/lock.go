@@ -0,0 +1,229 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package zookeeper
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HeavyHorst/easykv/lock"
+	zk "github.com/tevino/go-zookeeper/zk"
+)
+
+// candidatePrefix is the name prefix of the sequential nodes of locks and elections.
+const candidatePrefix = "lock-"
+
+// closed is returned by Done if there is nothing to wait for.
+var closed = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// Lock acquires the lock key with the zookeeper lock recipe: every contender creates
+// a sequential ephemeral node below key, the one with the lowest sequence number holds the lock.
+// The lock is lost if the session of the client expires.
+func (c *Client) Lock(ctx context.Context, key string) (lock.Lock, error) {
+	l, err := c.enqueue(ctx, key, "")
+	if err != nil {
+		return nil, err
+	}
+	return &mutex{l}, nil
+}
+
+// enqueue creates a sequential ephemeral node with value below key
+// and waits until it is the first one or ctx is done.
+func (c *Client) enqueue(ctx context.Context, key, value string) (*lease, error) {
+	node := path.Join(key, candidatePrefix)
+	if err := c.createParents(ctx, node); err != nil {
+		return nil, wrapError(err)
+	}
+	created, err := c.client.Create(node, []byte(value), zk.FlagEphemeral|zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	if err != nil {
+		return nil, wrapError(err)
+	}
+	l, err := c.waitFirst(ctx, key, created)
+	if err != nil {
+		c.client.Delete(created, -1)
+		return nil, err
+	}
+	return l, nil
+}
+
+// waitFirst waits until node has the lowest sequence number below key.
+func (c *Client) waitFirst(ctx context.Context, key, node string) (*lease, error) {
+	_, stat, err := c.client.Exists(node)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	for {
+		children, _, err := c.client.Children(key)
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		prev := predecessor(children, path.Base(node))
+		if prev == "" {
+			l := &lease{
+				c:     c,
+				key:   node,
+				czxid: stat.Czxid,
+				stop:  make(chan struct{}),
+				done:  make(chan struct{}),
+			}
+			go l.watch()
+			return l, nil
+		}
+
+		// only the predecessor is watched, so a release wakes up a single contender
+		exists, _, w, err := c.client.ExistsW(path.Join(key, prev))
+		if err != nil {
+			return nil, wrapError(err)
+		}
+		if !exists {
+			c.client.RemoveWatcher(w)
+			continue
+		}
+		select {
+		case <-w.EvtCh:
+		case <-ctx.Done():
+			c.client.RemoveWatcher(w)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// candidates returns the sequential nodes in children, sorted by their sequence number.
+func candidates(children []string) []string {
+	var list []string
+	for _, child := range children {
+		if strings.HasPrefix(child, candidatePrefix) {
+			list = append(list, child)
+		}
+	}
+	// the sequence numbers are zero-padded
+	sort.Strings(list)
+	return list
+}
+
+// predecessor returns the candidate before name, "" if name is the first one.
+func predecessor(children []string, name string) string {
+	var prev string
+	for _, child := range candidates(children) {
+		if child >= name {
+			break
+		}
+		prev = child
+	}
+	return prev
+}
+
+type mutex struct {
+	l *lease
+}
+
+func (m *mutex) Unlock(ctx context.Context) error {
+	return m.l.Close()
+}
+
+func (m *mutex) Done() <-chan struct{} {
+	return m.l.Done()
+}
+
+// Election returns a candidate for the election key, based on the lock recipe.
+// The leader is the candidate whose node has the lowest sequence number, the node holds its value.
+func (c *Client) Election(key string) lock.Election {
+	return &election{c: c, key: key}
+}
+
+type election struct {
+	c   *Client
+	key string
+
+	mu     sync.Mutex
+	leader *lease // of the won campaign
+}
+
+func (e *election) Campaign(ctx context.Context, value string) error {
+	l, err := e.c.enqueue(ctx, e.key, value)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = l
+	return nil
+}
+
+func (e *election) Resign(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader == nil {
+		return nil
+	}
+	err := e.leader.Close()
+	e.leader = nil
+	return err
+}
+
+func (e *election) Done() <-chan struct{} {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader == nil {
+		return closed
+	}
+	return e.leader.Done()
+}
+
+// Observe watches the children of the election key.
+func (e *election) Observe(ctx context.Context) <-chan string {
+	leaders := make(chan string)
+	go func() {
+		defer close(leaders)
+		var current string // node of the last leader
+		for {
+			children, _, w, err := e.c.client.ChildrenW(e.key)
+			if err != nil {
+				// the election key doesn't exist yet or the client reconnects
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+				}
+				continue
+			}
+
+			if list := candidates(children); len(list) > 0 && list[0] != current {
+				value, _, err := e.c.client.Get(path.Join(e.key, list[0]))
+				if err == nil {
+					current = list[0]
+					select {
+					case leaders <- string(value):
+					case <-ctx.Done():
+						e.c.client.RemoveWatcher(w)
+						return
+					}
+				}
+			}
+
+			select {
+			case <-w.EvtCh:
+			case <-ctx.Done():
+				e.c.client.RemoveWatcher(w)
+				return
+			}
+		}
+	}()
+	return leaders
+}
@@ -0,0 +1,39 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package zookeeper
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// Options contains all values that are needed to connect to zookeeper.
+type Options struct {
+	Logger *slog.Logger
+}
+
+// Option configures the zookeeper client.
+type Option func(*Options)
+
+// WithLogger sets the logger for watches and the connection log of the zookeeper library,
+// which otherwise writes to the standard logger.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = l
+	}
+}
+
+// zkLogger passes the connection log of the zookeeper library to a slog.Logger.
+type zkLogger struct {
+	logger *slog.Logger
+}
+
+func (l zkLogger) Printf(format string, args ...interface{}) {
+	l.logger.Info(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,37 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package zookeeper
+
+import (
+	"net/url"
+
+	"github.com/HeavyHorst/easykv"
+)
+
+func init() {
+	easykv.Register("zookeeper", open)
+	easykv.Register("zk", open)
+}
+
+// open creates a client from an url like
+//
+//	zookeeper://127.0.0.1:2181,127.0.0.2:2181/prefix
+//
+// The path is the prefix of all keys, see easykv.Prefixed.
+func open(u *url.URL) (easykv.ReadWatcher, error) {
+	if _, err := easykv.Query(u); err != nil {
+		return nil, err
+	}
+
+	c, err := New(easykv.Hosts(u))
+	if err != nil {
+		return nil, err
+	}
+	return easykv.Prefixed(c, u.Path), nil
+}
@@ -0,0 +1,278 @@
+/*
+ * This file is part of easyKV.
+ * © 2016 The easyKV Authors
+ *
+ * For the full copyright and license information, please view the LICENSE
+ * file that was distributed with this source code.
+ */
+
+package zookeeper
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/HeavyHorst/easykv"
+	zk "github.com/tevino/go-zookeeper/zk"
+)
+
+// eventWatcher keeps a data and a child watch on every node below a prefix
+// and translates the one-shot zookeeper watch events into easykv events.
+type eventWatcher struct {
+	c       *Client
+	ctx     context.Context
+	cancel  context.CancelFunc
+	prefix  string
+	keys    []string
+	in      chan watchEvent
+	out     chan easykv.Event
+	nodes   map[string]map[string]struct{} // node -> children
+	watches map[*zk.Watcher]struct{}       // watches that didn't fire yet
+}
+
+type watchEvent struct {
+	watch *zk.Watcher
+	zk.Event
+}
+
+// Watch streams all changes below prefix, which doesn't have to exist yet.
+// Zookeeper doesn't keep a history of changes, so WithWaitIndex is ignored.
+// The revision of a delete event is the pzxid of the parent, or of the closest ancestor
+// that still exists if the parent was deleted too, which can be later than the delete itself.
+func (c *Client) Watch(ctx context.Context, prefix string, opts ...easykv.WatchOption) (<-chan easykv.Event, error) {
+	var options easykv.WatchOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	prefix = strings.Replace(prefix, "/*", "", -1)
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	w := &eventWatcher{
+		c:       c,
+		ctx:     ctx,
+		cancel:  cancel,
+		prefix:  prefix,
+		keys:    options.Keys,
+		in:      make(chan watchEvent),
+		out:     make(chan easykv.Event),
+		nodes:   make(map[string]map[string]struct{}),
+		watches: make(map[*zk.Watcher]struct{}),
+	}
+	if err := w.add(prefix, false); err != nil {
+		w.stop()
+		return nil, wrapError(err)
+	}
+
+	go w.run()
+	return w.out, nil
+}
+
+func (w *eventWatcher) run() {
+	defer close(w.out)
+	defer w.stop()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case e := <-w.in:
+			delete(w.watches, e.watch)
+
+			var err error
+			switch e.Type {
+			case zk.EventNodeCreated:
+				err = w.add(e.Path, true)
+			case zk.EventNodeDataChanged:
+				err = w.dataChanged(e.Path)
+			case zk.EventNodeChildrenChanged:
+				err = w.childrenChanged(e.Path)
+			case zk.EventNodeDeleted:
+				err = w.deleted(e.Path)
+			case zk.EventNotWatching:
+				err = e.Err
+			}
+			if err != nil {
+				w.send(easykv.Event{Err: wrapError(err)})
+				return
+			}
+		}
+	}
+}
+
+// add watches node and all nodes below it.
+// If emit is true, a put event is sent for every leaf.
+// A missing prefix is watched until it is created, the missing nodes below are covered by the child watch of their parent.
+func (w *eventWatcher) add(node string, emit bool) error {
+	data, stat, dataWatch, err := w.c.client.GetW(node)
+	if err == zk.ErrNoNode {
+		if node == w.prefix {
+			return w.watchCreate(node, emit)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.forward(dataWatch)
+
+	children, _, childWatch, err := w.c.client.ChildrenW(node)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.forward(childWatch)
+
+	w.nodes[node] = make(map[string]struct{}, len(children))
+	if len(children) == 0 && emit {
+		w.send(easykv.Event{Key: node, Value: string(data), Type: easykv.EventPut, Revision: uint64(stat.Mzxid)})
+	}
+
+	for _, child := range children {
+		w.nodes[node][child] = struct{}{}
+		child = path.Join(node, child)
+		// the /zookeeper node is reserved by the server
+		if child == "/zookeeper" {
+			continue
+		}
+		if err := w.add(child, emit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchCreate waits for the creation of the missing node.
+func (w *eventWatcher) watchCreate(node string, emit bool) error {
+	exists, _, watch, err := w.c.client.ExistsW(node)
+	if err != nil {
+		return err
+	}
+	if exists {
+		// created in the meantime, the data watch of add replaces this one
+		w.c.client.RemoveWatcher(watch)
+		return w.add(node, emit)
+	}
+	w.forward(watch)
+	return nil
+}
+
+func (w *eventWatcher) dataChanged(node string) error {
+	data, stat, dataWatch, err := w.c.client.GetW(node)
+	if err == zk.ErrNoNode {
+		// the delete event follows
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.forward(dataWatch)
+
+	if len(w.nodes[node]) == 0 {
+		w.send(easykv.Event{Key: node, Value: string(data), Type: easykv.EventPut, Revision: uint64(stat.Mzxid)})
+	}
+	return nil
+}
+
+func (w *eventWatcher) childrenChanged(node string) error {
+	children, _, childWatch, err := w.c.client.ChildrenW(node)
+	if err == zk.ErrNoNode {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	w.forward(childWatch)
+
+	known := w.nodes[node]
+	current := make(map[string]struct{}, len(children))
+	for _, child := range children {
+		current[child] = struct{}{}
+		if _, ok := known[child]; ok {
+			continue
+		}
+		if err := w.add(path.Join(node, child), true); err != nil {
+			return err
+		}
+	}
+	w.nodes[node] = current
+	return nil
+}
+
+func (w *eventWatcher) deleted(node string) error {
+	children, ok := w.nodes[node]
+	if !ok {
+		// both watches of a node fire on delete
+		return nil
+	}
+	delete(w.nodes, node)
+
+	if len(children) == 0 {
+		revision, err := w.deleteRevision(node)
+		if err != nil {
+			return err
+		}
+		w.send(easykv.Event{Key: node, Type: easykv.EventDelete, Revision: revision})
+	}
+	if node == w.prefix {
+		return w.watchCreate(node, true)
+	}
+	return nil
+}
+
+// deleteRevision returns the zxid of the delete of node, which is the last child modification of its parent.
+// If the parent is gone too, the pzxid of the closest existing ancestor is used, the root always exists.
+func (w *eventWatcher) deleteRevision(node string) (uint64, error) {
+	for dir := path.Dir(node); ; dir = path.Dir(dir) {
+		exists, stat, err := w.c.client.Exists(dir)
+		if err != nil {
+			return 0, err
+		}
+		if exists || dir == "/" {
+			return uint64(stat.Pzxid), nil
+		}
+	}
+}
+
+// send sends e if its key is one we care about.
+func (w *eventWatcher) send(e easykv.Event) {
+	if e.Err == nil && !matchKeys(e.Key, w.keys) {
+		return
+	}
+
+	select {
+	case w.out <- e:
+	case <-w.ctx.Done():
+	}
+}
+
+// forward passes the single event of a zookeeper watch to the event loop.
+func (w *eventWatcher) forward(watch *zk.Watcher) {
+	w.watches[watch] = struct{}{}
+	go func() {
+		select {
+		case e, ok := <-watch.EvtCh:
+			if !ok {
+				return
+			}
+			select {
+			case w.in <- watchEvent{watch, e}:
+			case <-w.ctx.Done():
+			}
+		case <-w.ctx.Done():
+		}
+	}()
+}
+
+func (w *eventWatcher) stop() {
+	w.cancel()
+	for watch := range w.watches {
+		w.c.client.RemoveWatcher(watch)
+	}
+}